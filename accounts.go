@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/database"
+)
+
+// deleteAccount closes the caller's account. The user and their chirps
+// disappear right away but are only purged once the grace period is over,
+// until then an admin can restore them. Like changing the email, it takes
+// the current password or a fresh sign in, see requireReauth.
+func (cfg *apiConfig) deleteAccount(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    type body struct {
+        CurrentPassword string `json:"current_password"`
+        ReauthToken string `json:"reauth_token"`
+    }
+    rb := body{}
+    data, err := io.ReadAll(r.Body)
+    if err == nil && len(data) != 0 {
+        err = json.Unmarshal(data, &rb)
+    }
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    userRow, err := cfg.queries.GetUserById(r.Context(), validUuid)
+    if err != nil || userRow.DeletedAt.Valid {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    if !cfg.requireReauth(w, r, userRow, rb.CurrentPassword, rb.ReauthToken) {
+        return
+    }
+
+    tx, err := cfg.db.BeginTx(r.Context(), nil)
+    if err != nil {
+        http.Error(w, "Error deleting account", http.StatusInternalServerError)
+        return
+    }
+    defer tx.Rollback()
+    qtx := cfg.queriesTx(tx)
+
+    deletedAt, err := qtx.SoftDeleteUser(r.Context(), validUuid)
+    if err == nil {
+        _, err = qtx.RevokeRefreshTokensForUser(r.Context(), validUuid)
+    }
+    if err == nil {
+        _, err = qtx.DeleteAPIKeysForUser(r.Context(), validUuid)
+    }
+    if err == nil {
+        err = tx.Commit()
+    }
+    if err != nil {
+        http.Error(w, "Error deleting account", http.StatusInternalServerError)
+        return
+    }
+
+    type out struct {
+        DeletedAt time.Time `json:"deleted_at"`
+        PurgeAt time.Time `json:"purge_at"`
+    }
+    d, _ := json.Marshal(out{ deletedAt.Time, deletedAt.Time.Add(cfg.deletionGrace) })
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    w.Write(d)
+}
+
+// restoreAccount undoes deleteAccount while the grace period lasts. The user
+// has to log in again, their sessions and API keys are gone for good.
+func (cfg *apiConfig) restoreAccount(w http.ResponseWriter, r *http.Request) {
+    if !cfg.requireAdmin(w, r) {
+        return
+    }
+
+    userID, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        http.Error(w, "no deleted user", http.StatusNotFound)
+        return
+    }
+
+    param := database.RestoreUserParams{ ID: userID, GraceSecs: cfg.deletionGrace.Seconds() }
+    n, err := cfg.queries.RestoreUser(r.Context(), param)
+    if err != nil {
+        http.Error(w, "Error restoring user", http.StatusInternalServerError)
+        return
+    }
+    if n == 0 {
+        http.Error(w, "no deleted user", http.StatusNotFound)
+        return
+    }
+
+    userRow, err := cfg.queries.GetUserById(r.Context(), userID)
+    if errors.Is(err, sql.ErrNoRows) {
+        http.Error(w, "no deleted user", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, "Error restoring user", http.StatusInternalServerError)
+        return
+    }
+
+    type out struct {
+        ID uuid.UUID `json:"id"`
+        Email string `json:"email"`
+    }
+    d, _ := json.Marshal(out{ userRow.ID, userRow.Email })
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    w.Write(d)
+}
+
+// purgeDeletedUsers removes users whose grace period has run out. Their
+// chirps and everything else they own go with them by cascade.
+func (cfg *apiConfig) purgeDeletedUsers(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        n, err := cfg.queries.PurgeDeletedUsers(ctx, cfg.deletionGrace.Seconds())
+        if err != nil {
+            slog.Error("purging deleted users failed", "err", err)
+        } else if n > 0 {
+            slog.Info("purged deleted users", "count", n)
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDeleteAccount(t *testing.T) {
+    tests := []struct {
+        name string
+        noPassword bool
+        body string
+        // see reauthToken
+        reauth string
+        wantStatus int
+    }{
+        {
+            name: "Right password",
+            body: `{"current_password": "hunter2"}`,
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "Wrong password",
+            body: `{"current_password": "nope"}`,
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Missing password",
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Identity provider account without a fresh sign in",
+            noPassword: true,
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Identity provider account with a fresh sign in",
+            noPassword: true,
+            reauth: "self",
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "Identity provider account with an access token for a sign in",
+            noPassword: true,
+            reauth: "access",
+            wantStatus: http.StatusForbidden,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            userID := uuid.New()
+            user := testUser{ id: userID, email: "a@example.com", hash: mustHash(t, "hunter2") }
+            if tt.noPassword {
+                user.hash = ""
+            }
+            db.serveUser(user)
+            deletedAt := time.Now().UTC().Truncate(time.Second)
+            db.on("SoftDeleteUser", func([]driver.Value) fakeResult {
+                return rows("deleted_at", row(deletedAt))
+            })
+            db.on("RevokeRefreshTokensForUser", func([]driver.Value) fakeResult { return affected(2) })
+            db.on("DeleteAPIKeysForUser", func([]driver.Value) fakeResult { return affected(1) })
+
+            body := tt.body
+            if len(tt.reauth) != 0 {
+                body = `{"reauth_token": "` + reauthToken(t, cfg, userID, tt.reauth) + `"}`
+            }
+            w := do(cfg.deleteAccount, "DELETE", "/api/users", bearer(t, cfg, userID), body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("deleteAccount() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+
+            wantCalls := 0
+            if tt.wantStatus == http.StatusOK {
+                wantCalls = 1
+            }
+            for _, name := range []string{ "SoftDeleteUser", "RevokeRefreshTokensForUser", "DeleteAPIKeysForUser" } {
+                calls := db.called(name)
+                if len(calls) != wantCalls {
+                    t.Fatalf("%s called %d times, want %d", name, len(calls), wantCalls)
+                }
+                if wantCalls != 0 && calls[0][0] != userID.String() {
+                    t.Errorf("%s user = %v, want %s", name, calls[0][0], userID)
+                }
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+
+            got := struct {
+                DeletedAt time.Time `json:"deleted_at"`
+                PurgeAt time.Time `json:"purge_at"`
+            }{}
+            err := json.Unmarshal(w.Body.Bytes(), &got)
+            if err != nil {
+                t.Fatalf("deleteAccount() body isn't JSON: %v", err)
+            }
+            if !got.DeletedAt.Equal(deletedAt) || !got.PurgeAt.Equal(deletedAt.Add(cfg.deletionGrace)) {
+                t.Errorf("deleteAccount() = %s, want deleted at %s and purged a grace period later", w.Body, deletedAt)
+            }
+        })
+    }
+}
+
+func TestRestoreAccount(t *testing.T) {
+    userID := uuid.New()
+    tests := []struct {
+        name string
+        authorization string
+        restored int64
+        wantStatus int
+    }{
+        {
+            name: "Deleted within the grace period",
+            authorization: "ApiKey admin-key",
+            restored: 1,
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "Not deleted or already past the grace period",
+            authorization: "ApiKey admin-key",
+            wantStatus: http.StatusNotFound,
+        },
+        {
+            name: "Not an admin",
+            authorization: "ApiKey nope",
+            restored: 1,
+            wantStatus: http.StatusUnauthorized,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            cfg.adminKey = "admin-key"
+            db.serveUser(testUser{ id: userID, email: "a@example.com" })
+            db.on("RestoreUser", func([]driver.Value) fakeResult { return affected(tt.restored) })
+
+            r := newRequest("POST", "/admin/users/" + userID.String() + "/restore", tt.authorization, "")
+            r.SetPathValue("userID", userID.String())
+            w := record(cfg.restoreAccount, r)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("restoreAccount() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if tt.wantStatus == http.StatusUnauthorized {
+                if n := len(db.called("RestoreUser")); n != 0 {
+                    t.Errorf("RestoreUser called %d times for a non admin", n)
+                }
+                return
+            }
+
+            // the cutoff is worked out by the database from the grace period
+            calls := db.called("RestoreUser")
+            if len(calls) != 1 || calls[0][0] != userID.String() || calls[0][1] != cfg.deletionGrace.Seconds() {
+                t.Errorf("RestoreUser args = %v, want %s and %v seconds", calls, userID, cfg.deletionGrace.Seconds())
+            }
+        })
+    }
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+    cfg, db := newTestConfig(t)
+    // cancelling during the first purge makes the loop return after it
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    db.on("PurgeDeletedUsers", func([]driver.Value) fakeResult {
+        cancel()
+        return affected(3)
+    })
+    cfg.purgeDeletedUsers(ctx, time.Hour)
+
+    calls := db.called("PurgeDeletedUsers")
+    if len(calls) != 1 || calls[0][0] != cfg.deletionGrace.Seconds() {
+        t.Errorf("PurgeDeletedUsers args = %v, want one purge with %v seconds of grace", calls, cfg.deletionGrace.Seconds())
+    }
+}
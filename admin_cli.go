@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/trice/Chirpy/internal/config"
+	"github.com/trice/Chirpy/internal/database"
+	"github.com/trice/Chirpy/internal/fakedata"
+	"github.com/trice/Chirpy/internal/fixtures"
+)
+
+// withQueries opens the database for a command and runs fn in a single
+// transaction, so a command either does everything it says or nothing.
+func withQueries(ctx context.Context, conf config.Config, fn func(q *database.Queries) error) error {
+    db, err := openDB(ctx, conf)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+
+    tx, err := db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    err = fn(database.New(tx))
+    if err != nil {
+        return err
+    }
+    return tx.Commit()
+}
+
+// userByEmail is how every command finds the user it is about
+func userByEmail(ctx context.Context, q *database.Queries, email string) (database.User, error) {
+    if len(email) == 0 {
+        return database.User{}, errors.New("-email is required")
+    }
+    user, err := q.GetUser(ctx, email)
+    if errors.Is(err, sql.ErrNoRows) {
+        return database.User{}, fmt.Errorf("no user with email %s", email)
+    }
+    return user, err
+}
+
+// runUser is "chirpy user <create|disable|enable|admin|red> -email ...".
+func runUser(ctx context.Context, conf config.Config, args []string) error {
+    if len(args) == 0 {
+        return errors.New("user needs an action: create, disable, enable, admin or red")
+    }
+    action := args[0]
+
+    fs := flag.NewFlagSet("user " + action, flag.ContinueOnError)
+    email := fs.String("email", "", "the user's email address")
+    revoke := fs.Bool("revoke", false, "take admin or Red away instead of granting it")
+    var password *string
+    var admin, red *bool
+    var days *int
+    switch action {
+    case "create":
+        password = fs.String("password", "", "password, read from stdin when empty")
+        admin = fs.Bool("admin", false, "make the user an admin")
+        red = fs.Bool("red", false, "give the user Chirpy Red")
+    case "red":
+        days = fs.Int("days", 30, "how long the granted Red lasts")
+    }
+    err := fs.Parse(args[1:])
+    if err != nil {
+        return err
+    }
+
+    switch action {
+    case "create":
+        if len(*password) == 0 {
+            *password, err = readPassword()
+            if err != nil {
+                return err
+            }
+        }
+        f := fixtures.Fixtures{ Users: []fixtures.User {
+            { Email: *email, Password: *password, IsAdmin: *admin, IsChirpyRed: *red },
+        } }
+        if len(*email) == 0 {
+            return errors.New("-email is required")
+        }
+        return withQueries(ctx, conf, func(q *database.Queries) error {
+            _, err := fixtures.Apply(ctx, q, f)
+            if err == nil {
+                fmt.Printf("created %s\n", *email)
+            }
+            return err
+        })
+
+    case "disable", "enable":
+        return withQueries(ctx, conf, func(q *database.Queries) error {
+            user, err := userByEmail(ctx, q, *email)
+            if err != nil {
+                return err
+            }
+            if action == "enable" {
+                _, err = q.SetUserDisabled(ctx, database.SetUserDisabledParams{ ID: user.ID })
+                if err == nil {
+                    fmt.Printf("enabled %s\n", user.Email)
+                }
+                return err
+            }
+            return disableUser(ctx, q, user)
+        })
+
+    case "admin":
+        return withQueries(ctx, conf, func(q *database.Queries) error {
+            user, err := userByEmail(ctx, q, *email)
+            if err != nil {
+                return err
+            }
+            _, err = q.SetUserAdmin(ctx, database.SetUserAdminParams{ ID: user.ID, IsAdmin: !*revoke })
+            if err == nil {
+                fmt.Printf("%s is admin: %v\n", user.Email, !*revoke)
+            }
+            return err
+        })
+
+    case "red":
+        return withQueries(ctx, conf, func(q *database.Queries) error {
+            user, err := userByEmail(ctx, q, *email)
+            if err != nil {
+                return err
+            }
+            if *revoke {
+                err = setRed(ctx, q, user.ID, false)
+                if err == nil {
+                    err = q.EndSubscription(ctx, user.ID)
+                }
+                if err == nil {
+                    fmt.Printf("took Chirpy Red away from %s\n", user.Email)
+                }
+                return err
+            }
+
+            // a granted subscription runs out like a paid one would
+            now := time.Now()
+            err = setRed(ctx, q, user.ID, true)
+            if err == nil {
+                err = q.UpsertSubscription(ctx, database.UpsertSubscriptionParams {
+                    UserID: user.ID,
+                    Plan: "red_granted",
+                    Status: subscriptionActive,
+                    CurrentPeriodStart: now,
+                    CurrentPeriodEnd: now.Add(time.Duration(*days) * 24 * time.Hour),
+                })
+            }
+            if err == nil {
+                fmt.Printf("gave %s Chirpy Red for %d days\n", user.Email, *days)
+            }
+            return err
+        })
+
+    default:
+        return fmt.Errorf("unknown user action %q", action)
+    }
+}
+
+// disableUser keeps the user from signing in again. Their refresh tokens
+// and API keys go, and access tokens already handed out stop working on the
+// next request since authenticateToken checks the account every time.
+func disableUser(ctx context.Context, q *database.Queries, user database.User) error {
+    _, err := q.SetUserDisabled(ctx, database.SetUserDisabledParams {
+        ID: user.ID,
+        DisabledAt: sql.NullTime{ Time: time.Now(), Valid: true },
+    })
+    if err != nil {
+        return err
+    }
+    tokens, err := q.RevokeRefreshTokensForUser(ctx, user.ID)
+    if err != nil {
+        return err
+    }
+    keys, err := q.DeleteAPIKeysForUser(ctx, user.ID)
+    if err != nil {
+        return err
+    }
+    fmt.Printf("disabled %s, revoked %d refresh tokens and %d API keys\n", user.Email, tokens, keys)
+    return nil
+}
+
+func readPassword() (string, error) {
+    fmt.Fprint(os.Stderr, "password: ")
+    line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+    password := strings.TrimRight(line, "\r\n")
+    if len(password) == 0 {
+        if err == nil {
+            err = errors.New("empty password")
+        }
+        return "", err
+    }
+    return password, nil
+}
+
+// runTokens is "chirpy tokens revoke -email ...", signing the user out
+// everywhere.
+func runTokens(ctx context.Context, conf config.Config, args []string) error {
+    if len(args) == 0 || args[0] != "revoke" {
+        return errors.New("tokens needs an action: revoke")
+    }
+    fs := flag.NewFlagSet("tokens revoke", flag.ContinueOnError)
+    email := fs.String("email", "", "the user's email address")
+    err := fs.Parse(args[1:])
+    if err != nil {
+        return err
+    }
+
+    return withQueries(ctx, conf, func(q *database.Queries) error {
+        user, err := userByEmail(ctx, q, *email)
+        if err != nil {
+            return err
+        }
+        n, err := q.RevokeRefreshTokensForUser(ctx, user.ID)
+        if err == nil {
+            fmt.Printf("revoked %d refresh tokens of %s\n", n, user.Email)
+        }
+        return err
+    })
+}
+
+// runChirps is "chirpy chirps purge -email ...".
+func runChirps(ctx context.Context, conf config.Config, args []string) error {
+    if len(args) == 0 || args[0] != "purge" {
+        return errors.New("chirps needs an action: purge")
+    }
+    fs := flag.NewFlagSet("chirps purge", flag.ContinueOnError)
+    email := fs.String("email", "", "the author's email address")
+    err := fs.Parse(args[1:])
+    if err != nil {
+        return err
+    }
+
+    return withQueries(ctx, conf, func(q *database.Queries) error {
+        user, err := userByEmail(ctx, q, *email)
+        if err != nil {
+            return err
+        }
+        n, err := q.DeleteChirpsByUser(ctx, user.ID)
+        if err == nil {
+            fmt.Printf("deleted %d chirps by %s\n", n, user.Email)
+        }
+        return err
+    })
+}
+
+// runSeed is "chirpy seed -file fixtures/dev.json" for hand written data,
+// or "chirpy seed -generate -password ... -users 100 -chirps 2000" for made
+// up data. Like the dev reset it is for local development, other platforms
+// need -force.
+func runSeed(ctx context.Context, conf config.Config, args []string) error {
+    defaults := fakedata.DefaultOptions()
+    fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+    file := fs.String("file", "fixtures/dev.json", "fixtures to load")
+    generate := fs.Bool("generate", false, "make up data instead of loading -file")
+    users := fs.Int("users", defaults.Users, "users to generate")
+    chirps := fs.Int("chirps", defaults.Chirps, "chirps to generate")
+    follows := fs.Int("follows", defaults.FollowsPerUser, "average follows per generated user")
+    span := fs.Duration("span", defaults.Span, "how far back generated data goes")
+    seed := fs.Int64("seed", defaults.Seed, "same seed, same data")
+    password := fs.String("password", "", "password of every generated user, required with -generate")
+    force := fs.Bool("force", false, "seed even though the platform isn't dev")
+    err := fs.Parse(args)
+    if err != nil {
+        return err
+    }
+
+    if !conf.IsDev() && !*force {
+        return fmt.Errorf("seed is for local development, the platform is %q; pass -force to seed anyway", conf.Platform)
+    }
+    if *generate && len(*password) == 0 {
+        return errors.New("seed -generate needs -password for the generated users")
+    }
+
+    if *generate {
+        opts := fakedata.Options {
+            Users: *users,
+            Chirps: *chirps,
+            FollowsPerUser: *follows,
+            Span: *span,
+            Now: time.Now(),
+            Seed: *seed,
+        }
+        data := fakedata.Generate(opts)
+        return withQueries(ctx, conf, func(q *database.Queries) error {
+            summary, err := fakedata.Apply(ctx, q, data, *password)
+            if err == nil {
+                fmt.Printf("created %d users, %d follows and %d chirps\n", summary.Users, summary.Follows, summary.Chirps)
+            }
+            return err
+        })
+    }
+
+    f, err := fixtures.Load(*file)
+    if err != nil {
+        return err
+    }
+    return withQueries(ctx, conf, func(q *database.Queries) error {
+        summary, err := fixtures.Apply(ctx, q, f)
+        if err == nil {
+            fmt.Printf("created %d users and %d chirps\n", summary.Users, summary.Chirps)
+        }
+        return err
+    })
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/trice/Chirpy/internal/config"
+)
+
+// every case is turned down before a database is opened
+func TestRunSeedRefuses(t *testing.T) {
+    tests := []struct {
+        name string
+        platform string
+        args []string
+    }{
+        {
+            name: "Not dev",
+            platform: "prod",
+            args: []string{ "-generate", "-password", "hunter2" },
+        },
+        {
+            name: "Fixtures outside dev",
+            platform: "prod",
+            args: []string{ "-file", "fixtures/dev.json" },
+        },
+        {
+            name: "Generated users need a password",
+            platform: "dev",
+            args: []string{ "-generate" },
+        },
+        {
+            name: "Forced, but still no password",
+            platform: "prod",
+            args: []string{ "-generate", "-force" },
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            conf := config.Config{ Platform: tt.platform }
+            err := runSeed(t.Context(), conf, tt.args)
+            if err == nil {
+                t.Fatalf("runSeed(%v) on %s didn't refuse", tt.args, tt.platform)
+            }
+        })
+    }
+}
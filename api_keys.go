@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/database"
+)
+
+// apiKeyView is what listings show, the key itself is never returned again
+// after creation, only the first few characters to tell keys apart
+type apiKeyView struct {
+    ID uuid.UUID `json:"id"`
+    Name string `json:"name"`
+    Prefix string `json:"prefix"`
+    Scope string `json:"scope"`
+    CreatedAt time.Time `json:"created_at"`
+    LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func (cfg *apiConfig) createAPIKey(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    type body struct {
+        Name string `json:"name"`
+        Scope string `json:"scope"`
+    }
+    data, err := io.ReadAll(r.Body)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    rb := body{}
+    err = json.Unmarshal(data, &rb)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    if len(rb.Name) == 0 {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"name is required"}`))
+        return
+    }
+
+    scopes, err := auth.ParseScopes(rb.Scope)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"invalid scope"}`))
+        return
+    }
+
+    key, err := auth.MakeAPIKey()
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    param := database.CreateAPIKeyParams {
+        UserID: validUuid,
+        Name: rb.Name,
+        Prefix: key[:len(auth.APIKeyPrefix)+6],
+        KeyHash: auth.HashToken(key),
+        Scope: strings.Join(scopes, " "),
+    }
+    row, err := cfg.queries.CreateAPIKey(r.Context(), param)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    type out struct {
+        apiKeyView
+        Key string `json:"key"`
+    }
+    created := out {
+        apiKeyView{ row.ID, row.Name, row.Prefix, row.Scope, row.CreatedAt, nil },
+        key,
+    }
+    d, _ := json.Marshal(created)
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusCreated)
+    w.Write(d)
+}
+
+func (cfg *apiConfig) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    rows, err := cfg.queries.ListAPIKeysForUser(r.Context(), validUuid)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    keys := make([]apiKeyView, 0, len(rows))
+    for _, row := range rows {
+        view := apiKeyView{ row.ID, row.Name, row.Prefix, row.Scope, row.CreatedAt, nil }
+        if row.LastUsedAt.Valid {
+            view.LastUsedAt = &row.LastUsedAt.Time
+        }
+        keys = append(keys, view)
+    }
+
+    d, _ := json.Marshal(keys)
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    w.Write(d)
+}
+
+func (cfg *apiConfig) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    keyID, err := uuid.Parse(r.PathValue("keyID"))
+    if err != nil {
+        http.Error(w, "api key not found", http.StatusNotFound)
+        return
+    }
+
+    param := database.DeleteAPIKeyForUserParams {
+        ID: keyID,
+        UserID: validUuid,
+    }
+    deleted, err := cfg.queries.DeleteAPIKeyForUser(r.Context(), param)
+    if err != nil || deleted == 0 {
+        http.Error(w, "api key not found", http.StatusNotFound)
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    w.WriteHeader(http.StatusNoContent)
+}
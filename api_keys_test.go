@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/auth"
+)
+
+func TestAPIKeysOnlyWorkWhereTheirScopeIs(t *testing.T) {
+    userID := uuid.New()
+    key, err := auth.MakeAPIKey()
+    if err != nil {
+        t.Fatal(err)
+    }
+    thirdParty, err := auth.MakeJWT(userID, "test-secret", time.Hour, auth.ScopeChirpsWrite)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name string
+        authorization string
+        method string
+        target string
+        body string
+        handler func(cfg *apiConfig) http.HandlerFunc
+        wantStatus int
+    }{
+        {
+            name: "First party token lists keys",
+            method: "GET",
+            target: "/api/users/me/api-keys",
+            handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.listAPIKeys },
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "chirps:write key writes chirps",
+            authorization: "Bearer " + key,
+            method: "POST",
+            target: "/api/chirps",
+            body: `{"body": "beep"}`,
+            handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.createChirp },
+            wantStatus: http.StatusCreated,
+        },
+        {
+            name: "chirps:write key can't list keys",
+            authorization: "Bearer " + key,
+            method: "GET",
+            target: "/api/users/me/api-keys",
+            handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.listAPIKeys },
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "chirps:write key can't mint keys",
+            authorization: "Bearer " + key,
+            method: "POST",
+            target: "/api/users/me/api-keys",
+            body: `{"name": "another", "scope": "chirps:write"}`,
+            handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.createAPIKey },
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "chirps:write key can't request an export",
+            authorization: "Bearer " + key,
+            method: "POST",
+            target: "/api/users/me/export",
+            handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.requestExport },
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "chirps:write key can't download an export",
+            authorization: "Bearer " + key,
+            method: "GET",
+            target: "/api/users/me/export",
+            handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.downloadExport },
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "Admin's chirps:write key isn't an admin",
+            authorization: "Bearer " + key,
+            method: "GET",
+            target: "/admin/webhooks",
+            handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.listWebhookEvents },
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "Unknown API key",
+            authorization: "Bearer " + auth.APIKeyPrefix + "nope",
+            method: "GET",
+            target: "/api/users/me/api-keys",
+            handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.listAPIKeys },
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "Third party token",
+            authorization: "Bearer " + thirdParty,
+            method: "GET",
+            target: "/api/users/me/api-keys",
+            handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.listAPIKeys },
+            wantStatus: http.StatusUnauthorized,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            cfg.adminKey = "admin-key"
+            db.serveUser(testUser{ id: userID, email: "a@example.com", isAdmin: true })
+            db.on("GetAPIKeyByHash", func(args []driver.Value) fakeResult {
+                if args[0] != auth.HashToken(key) {
+                    return rows("id,user_id,scope")
+                }
+                return rows("id,user_id,scope", row(uuid.New(), userID, auth.ScopeChirpsWrite))
+            })
+            db.on("TouchAPIKey", nil)
+            db.on("ListAPIKeysForUser", func([]driver.Value) fakeResult {
+                return rows("id,name,prefix,scope,created_at,last_used_at")
+            })
+            db.on("CountChirpsByUserWithin", func([]driver.Value) fakeResult { return rows("count", row(0)) })
+            db.on("CreateChirp", func(args []driver.Value) fakeResult {
+                return rows(chirpColumns, row(uuid.New(), time.Now(), time.Now(), args[0], userID, time.Now()))
+            })
+
+            authorization := tt.authorization
+            if len(authorization) == 0 {
+                authorization = bearer(t, cfg, userID)
+            }
+            w := do(tt.handler(cfg), tt.method, tt.target, authorization, tt.body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("%s %s status = %d, want %d: %s", tt.method, tt.target, w.Code, tt.wantStatus, w.Body)
+            }
+            for _, name := range []string{ "CreateAPIKey", "GetLatestDataExport", "CreateDataExport", "ListWebhookEvents" } {
+                if n := len(db.called(name)); n != 0 {
+                    t.Errorf("%s called %d times", name, n)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/auth"
+)
+
+func TestInactiveAccountsCantUseTokens(t *testing.T) {
+    switchedOff := sql.NullTime{ Time: time.Now().Add(-time.Hour), Valid: true }
+    tests := []struct {
+        name string
+        disabled bool
+        deleted bool
+        apiKey bool
+        wantStatus int
+    }{
+        {
+            name: "Active user",
+            wantStatus: http.StatusCreated,
+        },
+        {
+            name: "Disabled user",
+            disabled: true,
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "Deleted user",
+            deleted: true,
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "Active user's API key",
+            apiKey: true,
+            wantStatus: http.StatusCreated,
+        },
+        {
+            name: "Disabled user's API key",
+            apiKey: true,
+            disabled: true,
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "Deleted user's API key",
+            apiKey: true,
+            deleted: true,
+            wantStatus: http.StatusUnauthorized,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            userID := uuid.New()
+            user := testUser{ id: userID, email: "a@example.com" }
+            if tt.disabled {
+                user.disabledAt = switchedOff
+            }
+            if tt.deleted {
+                user.deletedAt = switchedOff
+            }
+            db.serveUser(user)
+            // GetAPIKeyByHash joins users and only finds keys of active ones
+            db.on("GetAPIKeyByHash", func([]driver.Value) fakeResult {
+                if tt.disabled || tt.deleted {
+                    return rows("id,user_id,scope")
+                }
+                return rows("id,user_id,scope", row(uuid.New(), userID, auth.ScopeChirpsWrite))
+            })
+            db.on("TouchAPIKey", nil)
+            db.on("CountChirpsByUserWithin", func([]driver.Value) fakeResult { return rows("count", row(0)) })
+            db.on("CreateChirp", func(args []driver.Value) fakeResult {
+                return rows(chirpColumns, row(uuid.New(), time.Now(), time.Now(), args[0], userID, time.Now()))
+            })
+
+            authorization := bearer(t, cfg, userID)
+            if tt.apiKey {
+                key, err := auth.MakeAPIKey()
+                if err != nil {
+                    t.Fatal(err)
+                }
+                authorization = "Bearer " + key
+            }
+            w := do(cfg.createChirp, "POST", "/api/chirps", authorization, `{"body": "beep"}`)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("createChirp() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if created := len(db.called("CreateChirp")) != 0; created != (tt.wantStatus == http.StatusCreated) {
+                t.Errorf("CreateChirp called = %v", created)
+            }
+        })
+    }
+}
+
+func TestInactiveAccountsCantMintTokens(t *testing.T) {
+    switchedOff := sql.NullTime{ Time: time.Now().Add(-time.Hour), Valid: true }
+    // the example pair from RFC 7636 appendix B
+    verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+    challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+    tests := []struct {
+        name string
+        oauth bool
+        disabled bool
+        deleted bool
+        wantStatus int
+    }{
+        {
+            name: "Refresh for an active user",
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "Refresh for a disabled user",
+            disabled: true,
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "Refresh for a deleted user",
+            deleted: true,
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "OAuth code of an active user",
+            oauth: true,
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "OAuth code of a disabled user",
+            oauth: true,
+            disabled: true,
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "OAuth code of a deleted user",
+            oauth: true,
+            deleted: true,
+            wantStatus: http.StatusBadRequest,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            userID := uuid.New()
+            clientID := uuid.New()
+            user := testUser{ id: userID, email: "a@example.com" }
+            if tt.disabled {
+                user.disabledAt = switchedOff
+            }
+            if tt.deleted {
+                user.deletedAt = switchedOff
+            }
+            db.serveUser(user)
+            db.on("GetUserFromRefreshToken", func([]driver.Value) fakeResult {
+                return rows("user_id,expires_at,revoked_at", row(userID, time.Now().Add(time.Hour), nil))
+            })
+            db.on("GetOAuthClient", func([]driver.Value) fakeResult {
+                return rows("id,name,redirect_uri,secret_hash,user_id,created_at", row(clientID, "app", "https://app.example.com/cb", nil, uuid.New(), time.Now()))
+            })
+            db.on("ConsumeOAuthCode", func(args []driver.Value) fakeResult {
+                return rows("code_hash,client_id,user_id,redirect_uri,scope,code_challenge,expires_at,created_at,used_at",
+                    row(args[0], clientID, userID, "https://app.example.com/cb", auth.ScopeChirpsWrite, challenge, time.Now().Add(time.Minute), time.Now(), time.Now()))
+            })
+
+            handler, name := cfg.refreshToken, "refreshToken"
+            r := newRequest("POST", "/api/refresh", "Bearer refresh-token", "")
+            if tt.oauth {
+                form := url.Values {
+                    "grant_type": { "authorization_code" },
+                    "client_id": { clientID.String() },
+                    "code": { "code" },
+                    "redirect_uri": { "https://app.example.com/cb" },
+                    "code_verifier": { verifier },
+                }
+                handler, name = cfg.oauthToken, "oauthToken"
+                r = newRequest("POST", "/oauth/token", "", form.Encode())
+                r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+            }
+            w := record(handler, r)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("%s() status = %d, want %d: %s", name, w.Code, tt.wantStatus, w.Body)
+            }
+
+            got := map[string]any{}
+            json.Unmarshal(w.Body.Bytes(), &got)
+            _, refreshed := got["token"]
+            _, granted := got["access_token"]
+            if minted := refreshed || granted; minted != (tt.wantStatus == http.StatusOK) {
+                t.Errorf("%s() minted a token = %v: %s", name, minted, w.Body)
+            }
+        })
+    }
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const chirpColumns = "id,created_at,updated_at,body,user_id,publish_at"
+
+func TestCreateChirp(t *testing.T) {
+    userID := uuid.New()
+    tests := []struct {
+        name string
+        red bool
+        body string
+        publishIn time.Duration
+        recent int
+        countFails bool
+        wantStatus int
+        wantScheduled bool
+    }{
+        {
+            name: "Right away",
+            body: "hello",
+            wantStatus: http.StatusCreated,
+        },
+        {
+            name: "Publish time in the past goes out right away",
+            body: "hello",
+            publishIn: -time.Hour,
+            wantStatus: http.StatusCreated,
+        },
+        {
+            name: "Free users can't schedule",
+            body: "hello",
+            publishIn: time.Hour,
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Red users can schedule",
+            red: true,
+            body: "hello",
+            publishIn: 24 * time.Hour,
+            wantStatus: http.StatusCreated,
+            wantScheduled: true,
+        },
+        {
+            name: "Scheduled too far ahead",
+            red: true,
+            body: "hello",
+            publishIn: 31 * 24 * time.Hour,
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "Too long for free",
+            body: strings.Repeat("a", 141),
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "Long chirps with Red",
+            red: true,
+            body: strings.Repeat("a", 560),
+            wantStatus: http.StatusCreated,
+        },
+        {
+            name: "Hourly limit",
+            body: "hello",
+            recent: 30,
+            wantStatus: http.StatusTooManyRequests,
+        },
+        {
+            name: "Hourly limit can't be checked",
+            body: "hello",
+            countFails: true,
+            wantStatus: http.StatusInternalServerError,
+        },
+        {
+            name: "Hourly limit is higher with Red",
+            red: true,
+            body: "hello",
+            recent: 30,
+            wantStatus: http.StatusCreated,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            db.serveUser(testUser{ id: userID, email: "a@example.com", isChirpyRed: tt.red })
+            db.on("CountChirpsByUserWithin", func(args []driver.Value) fakeResult {
+                if tt.countFails {
+                    return fakeResult{ err: fmt.Errorf("connection reset") }
+                }
+                return rows("count", row(tt.recent))
+            })
+            db.on("CreateChirp", func(args []driver.Value) fakeResult {
+                publishAt := args[2]
+                if publishAt == nil {
+                    publishAt = time.Now()
+                }
+                return rows(chirpColumns, row(uuid.New(), time.Now(), time.Now(), args[0], userID, publishAt))
+            })
+
+            body := fmt.Sprintf(`{"body": %q}`, tt.body)
+            if tt.publishIn != 0 {
+                publishAt := time.Now().Add(tt.publishIn).Format(time.RFC3339)
+                body = fmt.Sprintf(`{"body": %q, "publish_at": %q}`, tt.body, publishAt)
+            }
+            w := do(cfg.createChirp, "POST", "/api/chirps", bearer(t, cfg, userID), body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("createChirp() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+
+            counts := db.called("CountChirpsByUserWithin")
+            if len(counts) != 1 || counts[0][1] != time.Hour.Seconds() {
+                t.Errorf("CountChirpsByUserWithin args = %v, want a one hour window", counts)
+            }
+            if tt.wantStatus != http.StatusCreated {
+                return
+            }
+            calls := db.called("CreateChirp")
+            if len(calls) != 1 {
+                t.Fatalf("CreateChirp called %d times, want once", len(calls))
+            }
+            // unscheduled chirps leave publish_at to the database
+            if scheduled := calls[0][2] != nil; scheduled != tt.wantScheduled {
+                t.Errorf("CreateChirp publish_at = %v, want scheduled %v", calls[0][2], tt.wantScheduled)
+            }
+        })
+    }
+}
+
+func TestEditChirp(t *testing.T) {
+    userID := uuid.New()
+    tests := []struct {
+        name string
+        red bool
+        author uuid.UUID
+        body string
+        wantStatus int
+    }{
+        {
+            name: "Red users can edit",
+            red: true,
+            author: userID,
+            body: "edited",
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "Free users can't",
+            author: userID,
+            body: "edited",
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Somebody else's chirp",
+            red: true,
+            author: uuid.New(),
+            body: "edited",
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Too long",
+            red: true,
+            author: userID,
+            body: strings.Repeat("a", 561),
+            wantStatus: http.StatusBadRequest,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            chirpID := uuid.New()
+            db.serveUser(testUser{ id: userID, email: "a@example.com", isChirpyRed: tt.red })
+            db.on("GetChirpById", func([]driver.Value) fakeResult {
+                return rows(chirpColumns, row(chirpID, time.Now(), time.Now(), "hello", tt.author, time.Now()))
+            })
+            db.on("UpdateChirpForUser", func(args []driver.Value) fakeResult {
+                return rows(chirpColumns, row(chirpID, time.Now(), time.Now(), args[2], userID, time.Now()))
+            })
+
+            r := newRequest("PUT", "/api/chirps/" + chirpID.String(), bearer(t, cfg, userID), fmt.Sprintf(`{"body": %q}`, tt.body))
+            r.SetPathValue("chirpID", chirpID.String())
+            w := record(cfg.editChirp, r)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("editChirp() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if updated := len(db.called("UpdateChirpForUser")) != 0; updated != (tt.wantStatus == http.StatusOK) {
+                t.Errorf("UpdateChirpForUser called = %v", updated)
+            }
+        })
+    }
+}
+
+func TestGetChirpBy(t *testing.T) {
+    authorID := uuid.New()
+    chirpID := uuid.New()
+    tests := []struct {
+        name string
+        scheduled bool
+        viewer string
+        wantStatus int
+    }{
+        {
+            name: "Published",
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "Scheduled",
+            scheduled: true,
+            wantStatus: http.StatusNotFound,
+        },
+        {
+            name: "Scheduled, seen by its author",
+            scheduled: true,
+            viewer: "author",
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "Scheduled, seen by somebody else",
+            scheduled: true,
+            viewer: "other",
+            wantStatus: http.StatusNotFound,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            otherID := uuid.New()
+            db.on("GetUserById", func(args []driver.Value) fakeResult {
+                return rows(userColumns, testUser{ id: uuid.MustParse(args[0].(string)), email: "a@example.com" }.row())
+            })
+            chirp := row(chirpID, time.Now(), time.Now(), "hello", authorID, time.Now().Add(time.Hour))
+            // the database decides what is published, going by its own clock
+            db.on("GetPublishedChirpById", func([]driver.Value) fakeResult {
+                if tt.scheduled {
+                    return rows(chirpColumns)
+                }
+                return rows(chirpColumns, chirp)
+            })
+            db.on("GetChirpById", func([]driver.Value) fakeResult { return rows(chirpColumns, chirp) })
+
+            authorization := ""
+            switch tt.viewer {
+            case "author":
+                authorization = bearer(t, cfg, authorID)
+            case "other":
+                authorization = bearer(t, cfg, otherID)
+            }
+            r := newRequest("GET", "/api/chirps/" + chirpID.String(), authorization, "")
+            r.SetPathValue("chirpID", chirpID.String())
+            w := record(cfg.getChirpBy, r)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("getChirpBy() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if len(tt.viewer) == 0 && len(db.called("GetChirpById")) != 0 {
+                t.Errorf("GetChirpById called for an anonymous viewer")
+            }
+        })
+    }
+}
+
+func TestGetChirps(t *testing.T) {
+    authorID := uuid.New()
+    tests := []struct {
+        name string
+        target string
+        queryFails bool
+        wantStatus int
+        wantQuery string
+    }{
+        {
+            name: "Everyone's",
+            target: "/api/chirps",
+            wantStatus: http.StatusOK,
+            wantQuery: "GetChirps",
+        },
+        {
+            name: "One author's",
+            target: "/api/chirps?author_id=" + authorID.String(),
+            wantStatus: http.StatusOK,
+            wantQuery: "GetChirpsByAuthor",
+        },
+        {
+            name: "Malformed author",
+            target: "/api/chirps?author_id=nope",
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "Query fails",
+            target: "/api/chirps",
+            queryFails: true,
+            wantStatus: http.StatusNotFound,
+            wantQuery: "GetChirps",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            answer := func([]driver.Value) fakeResult {
+                if tt.queryFails {
+                    return fakeResult{ err: fmt.Errorf("connection reset") }
+                }
+                return rows(chirpColumns, row(uuid.New(), time.Now(), time.Now(), "hello", authorID, time.Now()))
+            }
+            db.on("GetChirps", answer)
+            db.on("GetChirpsByAuthor", answer)
+
+            w := do(cfg.getChirps, "GET", tt.target, "", "")
+            if w.Code != tt.wantStatus {
+                t.Fatalf("getChirps() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            // nothing gets written after the error
+            if tt.queryFails && w.Body.String() != "Error reading chirps\n" {
+                t.Errorf("getChirps() kept writing after the error: %q", w.Body)
+            }
+            for _, name := range []string{ "GetChirps", "GetChirpsByAuthor" } {
+                if called := len(db.called(name)) != 0; called != (name == tt.wantQuery) {
+                    t.Errorf("%s called = %v", name, called)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/trice/Chirpy/internal/config"
+)
+
+// commands run instead of the server, as "chirpy [flags] <command> [args]"
+var commands = map[string]func(ctx context.Context, conf config.Config, args []string) error {
+    "migrate": runMigrate,
+    "user": runUser,
+    "tokens": runTokens,
+    "chirps": runChirps,
+    "seed": runSeed,
+}
+
+func runCommand(ctx context.Context, conf config.Config, args []string) error {
+    cmd, ok := commands[args[0]]
+    if !ok {
+        names := []string{}
+        for name := range commands {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        return fmt.Errorf("unknown command %q, try one of %s", args[0], strings.Join(names, ", "))
+    }
+    return cmd(ctx, conf, args[1:])
+}
+
+// runMigrate is "chirpy migrate [up|down|redo|status|version]", up being
+// the default.
+func runMigrate(ctx context.Context, conf config.Config, args []string) error {
+    action := "up"
+    if len(args) != 0 {
+        action = args[0]
+    }
+    if len(args) > 1 {
+        return fmt.Errorf("migrate takes one action, got %q", args)
+    }
+
+    db, err := openDB(ctx, conf)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+    migrator, err := newMigrator(db)
+    if err != nil {
+        return err
+    }
+
+    switch action {
+    case "up":
+        applied, err := migrator.Up(ctx)
+        for _, m := range applied {
+            fmt.Printf("applied %s\n", m.Name)
+        }
+        if err == nil && len(applied) == 0 {
+            fmt.Printf("already at version %d\n", migrator.Latest())
+        }
+        return err
+
+    case "down":
+        m, err := migrator.Down(ctx)
+        if err == nil {
+            fmt.Printf("rolled back %s\n", m.Name)
+        }
+        return err
+
+    case "redo":
+        m, err := migrator.Redo(ctx)
+        if err == nil {
+            fmt.Printf("redid %s\n", m.Name)
+        }
+        return err
+
+    case "status":
+        statuses, err := migrator.Status(ctx)
+        if err != nil {
+            return err
+        }
+        w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+        fmt.Fprintln(w, "APPLIED AT\tMIGRATION")
+        for _, s := range statuses {
+            at := "pending"
+            if s.Applied {
+                at = s.AppliedAt.Format(time.DateTime)
+            }
+            fmt.Fprintf(w, "%s\t%s\n", at, s.Name)
+        }
+        return w.Flush()
+
+    case "version":
+        version, err := migrator.Version(ctx)
+        if err == nil {
+            fmt.Println(version)
+        }
+        return err
+
+    default:
+        return fmt.Errorf("unknown migrate action %q, use up, down, redo, status or version", action)
+    }
+}
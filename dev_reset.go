@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/trice/Chirpy/internal/database"
+	"github.com/trice/Chirpy/internal/fixtures"
+	"github.com/trice/Chirpy/internal/logging"
+)
+
+// devReset wipes every table in one transaction, loads the dev fixtures and
+// zeroes the hit counter. Outside of dev the endpoint doesn't exist.
+func (cfg *apiConfig) devReset(w http.ResponseWriter, r *http.Request) {
+    if cfg.platform != "dev" {
+        http.NotFound(w, r)
+        return
+    }
+
+    // read the fixtures first, a typo in the file shouldn't cost the data
+    f := fixtures.Fixtures{}
+    if len(cfg.devFixtures) != 0 {
+        var err error
+        f, err = fixtures.Load(cfg.devFixtures)
+        if err != nil {
+            logging.FromContext(r.Context()).Error("loading dev fixtures", "file", cfg.devFixtures, "error", err)
+            http.Error(w, "Error loading fixtures", http.StatusInternalServerError)
+            return
+        }
+    }
+
+    tx, err := cfg.db.BeginTx(r.Context(), nil)
+    if err != nil {
+        http.Error(w, "Error resetting database", http.StatusInternalServerError)
+        return
+    }
+    defer tx.Rollback()
+    qtx := cfg.queriesTx(tx)
+
+    removed, err := qtx.CountResetRows(r.Context())
+    if err == nil {
+        err = qtx.TruncateAll(r.Context())
+    }
+    var seeded fixtures.Summary
+    if err == nil {
+        seeded, err = fixtures.Apply(r.Context(), qtx, f)
+    }
+    if err == nil {
+        err = tx.Commit()
+    }
+    if err != nil {
+        logging.FromContext(r.Context()).Error("resetting database", "error", err)
+        http.Error(w, "Error resetting database", http.StatusInternalServerError)
+        return
+    }
+
+    hits := cfg.metrics.fileserverHits.Value()
+    cfg.metrics.fileserverHits.Reset()
+
+    type out struct {
+        Removed database.CountResetRowsRow `json:"removed"`
+        FileserverHits float64 `json:"fileserver_hits"`
+        Seeded fixtures.Summary `json:"seeded"`
+    }
+    d, _ := json.Marshal(out{ removed, hits, seeded })
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    w.Write(d)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/database"
+	"github.com/trice/Chirpy/internal/dataexport"
+)
+
+const (
+    exportPending = "pending"
+    exportRunning = "running"
+    exportReady = "ready"
+    exportFailed = "failed"
+)
+
+type exportStatus struct {
+    ID uuid.UUID `json:"id"`
+    Status string `json:"status"`
+    CreatedAt time.Time `json:"created_at"`
+    CompletedAt *time.Time `json:"completed_at,omitempty"`
+    ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func newExportStatus(row database.GetLatestDataExportRow) exportStatus {
+    s := exportStatus{ ID: row.ID, Status: row.Status, CreatedAt: row.CreatedAt }
+    if row.CompletedAt.Valid {
+        s.CompletedAt = &row.CompletedAt.Time
+    }
+    if row.ExpiresAt.Valid {
+        s.ExpiresAt = &row.ExpiresAt.Time
+    }
+    return s
+}
+
+// requestExport queues an export of the caller's data for the export
+// worker. While one is still queued or running, that one is returned
+// instead of starting another.
+func (cfg *apiConfig) requestExport(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    latest, err := cfg.queries.GetLatestDataExport(r.Context(), validUuid)
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {
+        http.Error(w, "Error reading exports", http.StatusInternalServerError)
+        return
+    }
+    if err != nil || (latest.Status != exportPending && latest.Status != exportRunning) {
+        row, err := cfg.queries.CreateDataExport(r.Context(), validUuid)
+        if err != nil {
+            http.Error(w, "Error starting export", http.StatusInternalServerError)
+            return
+        }
+        latest = database.GetLatestDataExportRow(row)
+    }
+
+    d, _ := json.Marshal(newExportStatus(latest))
+    w.Header().Set("Location", "/api/users/me/export")
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusAccepted)
+    w.Write(d)
+}
+
+// downloadExport hands out the caller's latest export once it's ready, and
+// its status until then.
+func (cfg *apiConfig) downloadExport(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    latest, err := cfg.queries.GetLatestDataExport(r.Context(), validUuid)
+    if errors.Is(err, sql.ErrNoRows) {
+        http.Error(w, "no export", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, "Error reading exports", http.StatusInternalServerError)
+        return
+    }
+
+    if latest.Status != exportReady {
+        status := http.StatusAccepted
+        if latest.Status == exportFailed {
+            status = http.StatusInternalServerError
+        }
+        d, _ := json.Marshal(newExportStatus(latest))
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(status)
+        w.Write(d)
+        return
+    }
+
+    archive, err := cfg.queries.GetDataExportArchive(r.Context(), latest.ID)
+    if errors.Is(err, sql.ErrNoRows) {
+        http.Error(w, "export expired", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, "Error reading export", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/zip")
+    w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export-` + latest.CompletedAt.Time.Format("2006-01-02") + `.zip"`)
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(http.StatusOK)
+    w.Write(archive)
+}
+
+// runExports works through queued exports, then drops expired archives and
+// puts back exports a crashed worker left running.
+func (cfg *apiConfig) runExports(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        for ctx.Err() == nil {
+            job, err := cfg.queries.ClaimDataExport(ctx)
+            if errors.Is(err, sql.ErrNoRows) {
+                break
+            }
+            if err != nil {
+                slog.Error("claiming export failed", "err", err)
+                break
+            }
+            cfg.buildExport(ctx, job)
+        }
+
+        n, err := cfg.queries.DeleteExpiredDataExports(ctx)
+        if err != nil {
+            slog.Error("deleting expired exports failed", "err", err)
+        } else if n > 0 {
+            slog.Info("deleted expired exports", "count", n)
+        }
+
+        // started more than ten minutes ago by the database's clock
+        n, err = cfg.queries.RequeueStaleDataExports(ctx, (10 * time.Minute).Seconds())
+        if err != nil {
+            slog.Error("requeueing stale exports failed", "err", err)
+        } else if n > 0 {
+            slog.Warn("requeued stale exports", "count", n)
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (cfg *apiConfig) buildExport(ctx context.Context, job database.ClaimDataExportRow) {
+    log := slog.With("export_id", job.ID, "user_id", job.UserID)
+
+    archive, err := cfg.collectExport(ctx, job.UserID)
+    if err == nil {
+        param := database.CompleteDataExportParams {
+            ID: job.ID,
+            Archive: archive,
+            TtlSecs: cfg.exportTTL.Seconds(),
+        }
+        err = cfg.queries.CompleteDataExport(ctx, param)
+        if err == nil {
+            log.Info("export ready", "bytes", len(archive))
+            return
+        }
+    }
+
+    log.Error("export failed", "err", err)
+    param := database.FailDataExportParams {
+        ID: job.ID,
+        Error: sql.NullString{ String: err.Error(), Valid: true },
+    }
+    err = cfg.queries.FailDataExport(ctx, param)
+    if err != nil {
+        log.Error("marking export failed", "err", err)
+    }
+}
+
+// collectExport reads everything in one read only transaction so the
+// archive is a consistent snapshot
+func (cfg *apiConfig) collectExport(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+    tx, err := cfg.db.BeginTx(ctx, &sql.TxOptions{ Isolation: sql.LevelRepeatableRead, ReadOnly: true })
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    a, err := dataexport.Collect(ctx, cfg.queriesTx(tx), userID)
+    if err != nil {
+        return nil, err
+    }
+    return a.Zip()
+}
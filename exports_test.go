@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRunExports(t *testing.T) {
+    tests := []struct {
+        name string
+        collectFails bool
+        wantCompleted int
+        wantFailed int
+    }{
+        {
+            name: "Export builds",
+            wantCompleted: 1,
+        },
+        {
+            name: "Export fails",
+            collectFails: true,
+            wantFailed: 1,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            userID := uuid.New()
+            exportID := uuid.New()
+            claimed := false
+            db.on("ClaimDataExport", func([]driver.Value) fakeResult {
+                if claimed {
+                    return rows("id,user_id")
+                }
+                claimed = true
+                return rows("id,user_id", row(exportID, userID))
+            })
+            if !tt.collectFails {
+                db.serveUser(testUser{ id: userID, email: "a@example.com" })
+            }
+            for _, name := range []string{ "GetTOTPForUser", "GetSubscriptionForUser", "ListIdentitiesForUser", "ListChirpsForUser",
+                "ListFollowing", "ListFollowers", "ListRefreshTokensForUser", "ListAPIKeysForUser", "CompleteDataExport", "FailDataExport" } {
+                db.on(name, nil)
+            }
+            db.on("DeleteExpiredDataExports", func([]driver.Value) fakeResult { return affected(0) })
+            // cancelling during the first pass makes the loop return after it
+            ctx, cancel := context.WithCancel(context.Background())
+            defer cancel()
+            db.on("RequeueStaleDataExports", func([]driver.Value) fakeResult {
+                cancel()
+                return affected(0)
+            })
+
+            cfg.runExports(ctx, time.Hour)
+
+            // both times are worked out by the database, the app only
+            // passes durations
+            completed := db.called("CompleteDataExport")
+            if len(completed) != tt.wantCompleted {
+                t.Fatalf("CompleteDataExport called %d times, want %d", len(completed), tt.wantCompleted)
+            }
+            if len(completed) != 0 && (completed[0][0] != exportID.String() || completed[0][2] != cfg.exportTTL.Seconds()) {
+                t.Errorf("CompleteDataExport args = %v, want %s and %v seconds", completed[0], exportID, cfg.exportTTL.Seconds())
+            }
+            if n := len(db.called("FailDataExport")); n != tt.wantFailed {
+                t.Errorf("FailDataExport called %d times, want %d", n, tt.wantFailed)
+            }
+            requeued := db.called("RequeueStaleDataExports")
+            if len(requeued) != 1 || requeued[0][0] != (10 * time.Minute).Seconds() {
+                t.Errorf("RequeueStaleDataExports args = %v, want %v seconds", requeued, (10 * time.Minute).Seconds())
+            }
+        })
+    }
+}
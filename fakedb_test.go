@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/database"
+	"github.com/trice/Chirpy/internal/dbstats"
+	"github.com/trice/Chirpy/internal/entitlements"
+	"github.com/trice/Chirpy/internal/mail"
+	"github.com/trice/Chirpy/internal/ratelimit"
+	"github.com/trice/Chirpy/internal/tracing"
+)
+
+// fakeDB stands in for Postgres in handler tests. It answers sqlc queries by
+// their name, anything a test didn't set up fails the query.
+type fakeDB struct {
+    mu sync.Mutex
+    answers map[string]func(args []driver.Value) fakeResult
+    calls []fakeCall
+}
+
+type fakeResult struct {
+    cols []string
+    rows [][]driver.Value
+    affected int64
+    err error
+}
+
+type fakeCall struct {
+    name string
+    args []driver.Value
+}
+
+// on answers the query called name. A nil fn answers with no rows.
+func (f *fakeDB) on(name string, fn func(args []driver.Value) fakeResult) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if fn == nil {
+        fn = func([]driver.Value) fakeResult { return fakeResult{} }
+    }
+    f.answers[name] = fn
+}
+
+// called returns the arguments of every call of the query name
+func (f *fakeDB) called(name string) [][]driver.Value {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    var args [][]driver.Value
+    for _, c := range f.calls {
+        if c.name == name {
+            args = append(args, c.args)
+        }
+    }
+    return args
+}
+
+func (f *fakeDB) answer(query string, named []driver.NamedValue) fakeResult {
+    name := dbstats.QueryName(query)
+    args := make([]driver.Value, len(named))
+    for i, a := range named {
+        args[i] = a.Value
+    }
+
+    f.mu.Lock()
+    f.calls = append(f.calls, fakeCall{ name, args })
+    fn, ok := f.answers[name]
+    f.mu.Unlock()
+    if !ok {
+        return fakeResult{ err: fmt.Errorf("fakedb: unexpected query %s", name) }
+    }
+    return fn(args)
+}
+
+// row turns Go values into what a driver returns, so they scan like the
+// real thing
+func row(values ...any) []driver.Value {
+    out := make([]driver.Value, len(values))
+    for i, v := range values {
+        switch v := v.(type) {
+        case uuid.UUID:
+            out[i] = v.String()
+        case int:
+            out[i] = int64(v)
+        case driver.Valuer:
+            out[i], _ = v.Value()
+        default:
+            out[i] = v
+        }
+    }
+    return out
+}
+
+func rows(cols string, values ...[]driver.Value) fakeResult {
+    return fakeResult{ cols: strings.Split(cols, ","), rows: values }
+}
+
+func affected(n int64) fakeResult {
+    return fakeResult{ affected: n }
+}
+
+var (
+    fakeDBsMu sync.Mutex
+    fakeDBs = map[string]*fakeDB{}
+    registerFakeDriver sync.Once
+)
+
+func newFakeDB(t *testing.T) (*fakeDB, *sql.DB) {
+    registerFakeDriver.Do(func() {
+        sql.Register("chirpyfake", fakeDriver{})
+    })
+
+    f := &fakeDB{ answers: map[string]func([]driver.Value) fakeResult{} }
+    dsn := uuid.NewString()
+    fakeDBsMu.Lock()
+    fakeDBs[dsn] = f
+    fakeDBsMu.Unlock()
+
+    db, err := sql.Open("chirpyfake", dsn)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        db.Close()
+        fakeDBsMu.Lock()
+        delete(fakeDBs, dsn)
+        fakeDBsMu.Unlock()
+    })
+    return f, db
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+    fakeDBsMu.Lock()
+    defer fakeDBsMu.Unlock()
+    f, ok := fakeDBs[dsn]
+    if !ok {
+        return nil, fmt.Errorf("fakedb: no database %s", dsn)
+    }
+    return fakeConn{ f }, nil
+}
+
+type fakeConn struct {
+    f *fakeDB
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+    return nil, fmt.Errorf("fakedb: prepared statements aren't supported")
+}
+
+func (c fakeConn) Close() error { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+    return fakeTx{}, nil
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    res := c.f.answer(query, args)
+    if res.err != nil {
+        return nil, res.err
+    }
+    return &fakeRows{ res: res }, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+    res := c.f.answer(query, args)
+    if res.err != nil {
+        return nil, res.err
+    }
+    return driver.RowsAffected(res.affected), nil
+}
+
+// transactions aren't faked, the tests only look at which queries ran
+type fakeTx struct{}
+
+func (fakeTx) Commit() error { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+    res fakeResult
+    next int
+}
+
+func (r *fakeRows) Columns() []string { return r.res.cols }
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+    if r.next >= len(r.res.rows) {
+        return io.EOF
+    }
+    copy(dest, r.res.rows[r.next])
+    r.next++
+    return nil
+}
+
+// newTestConfig is an apiConfig running on a fakeDB, with nothing else
+// turned on
+func newTestConfig(t *testing.T) (*apiConfig, *fakeDB) {
+    f, db := newFakeDB(t)
+    stats := &dbstats.DB{ DB: db }
+    return &apiConfig {
+        metrics: newServerMetrics(),
+        db: db,
+        dbStats: stats,
+        queries: database.New(stats),
+        platform: "test",
+        tokenSecret: "test-secret",
+        mailer: mail.LogSender{ Out: io.Discard },
+        rateLimiter: ratelimit.NewMemoryStore(),
+        rateLimits: map[string]ratelimit.Limit{},
+        accessTokenTTL: time.Hour,
+        refreshTokenTTL: time.Hour,
+        deletionGrace: 24 * time.Hour,
+        exportTTL: time.Hour,
+        plans: entitlements.Default,
+        tracer: tracing.NewTracer(nil),
+    }, f
+}
+
+// testUser is a users row as GetUser and GetUserById return it
+type testUser struct {
+    id uuid.UUID
+    email string
+    hash string
+    isChirpyRed bool
+    isAdmin bool
+    disabledAt sql.NullTime
+    deletedAt sql.NullTime
+}
+
+const userColumns = "id,created_at,updated_at,email,hashed_password,is_chirpy_red,is_admin,disabled_at,deleted_at,username,display_name,bio,avatar_url"
+
+func (u testUser) row() []driver.Value {
+    now := time.Now()
+    return row(u.id, now, now, u.email, u.hash, u.isChirpyRed, u.isAdmin, u.disabledAt, u.deletedAt, nil, "", "", "")
+}
+
+// serveUser answers GetUserById and GetUser for u
+func (f *fakeDB) serveUser(u testUser) {
+    f.on("GetUserById", func(args []driver.Value) fakeResult {
+        if args[0] != u.id.String() {
+            return rows(userColumns)
+        }
+        return rows(userColumns, u.row())
+    })
+    f.on("GetUser", func(args []driver.Value) fakeResult {
+        if args[0] != u.email {
+            return rows(userColumns)
+        }
+        return rows(userColumns, u.row())
+    })
+}
+
+func mustHash(t *testing.T, password string) string {
+    hash, err := auth.HashPassword(password)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return hash
+}
+
+func bearer(t *testing.T, cfg *apiConfig, userID uuid.UUID) string {
+    tok, err := auth.MakeJWT(userID, cfg.tokenSecret, time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return "Bearer " + tok
+}
+
+// reauthToken makes the reauth_token requireReauth wants. whose is "self"
+// for userID's own, "other" for somebody else's and "access" for an access
+// token passed off as one.
+func reauthToken(t *testing.T, cfg *apiConfig, userID uuid.UUID, whose string) string {
+    var tok string
+    var err error
+    switch whose {
+    case "self":
+        tok, err = auth.MakeReauthToken(userID, cfg.tokenSecret, time.Minute)
+    case "other":
+        tok, err = auth.MakeReauthToken(uuid.New(), cfg.tokenSecret, time.Minute)
+    default:
+        tok, err = auth.MakeJWT(userID, cfg.tokenSecret, time.Minute)
+    }
+    if err != nil {
+        t.Fatal(err)
+    }
+    return tok
+}
+
+// do runs a request through handler and returns the recorded response
+func do(handler http.HandlerFunc, method, target, authorization, body string) *httptest.ResponseRecorder {
+    return record(handler, newRequest(method, target, authorization, body))
+}
+
+func newRequest(method, target, authorization, body string) *http.Request {
+    r := httptest.NewRequest(method, target, strings.NewReader(body))
+    if len(authorization) != 0 {
+        r.Header.Set("Authorization", authorization)
+    }
+    return r
+}
+
+func record(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+    w := httptest.NewRecorder()
+    handler(w, r)
+    return w
+}
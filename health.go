@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/trice/Chirpy/internal/health"
+)
+
+func (cfg *apiConfig) readinessChecks() *health.Checker {
+    checker := &health.Checker{}
+    checker.Add("database", cfg.db.PingContext)
+    // a deploy shouldn't get traffic before its migrations ran
+    checker.Add("migrations", func(ctx context.Context) error {
+        version, err := cfg.migrator.Version(ctx)
+        if err != nil {
+            return err
+        }
+        if version != cfg.migrator.Latest() {
+            return fmt.Errorf("database is at version %d, want %d", version, cfg.migrator.Latest())
+        }
+        return nil
+    })
+    return checker
+}
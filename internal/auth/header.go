@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Authorization schemes Chirpy understands. Matching is case-insensitive as
+// RFC 9110 requires.
+const (
+    SchemeBearer = "Bearer"
+    SchemeAPIKey = "ApiKey"
+)
+
+var (
+    ErrNoAuthHeader = errors.New("Auth not provided")
+    ErrMalformedAuthHeader = errors.New("Malformed Authorization header")
+    ErrWrongAuthScheme = errors.New("Unexpected Authorization scheme")
+)
+
+// ParseAuthHeader splits the Authorization header into its scheme and
+// credentials. More than one header, or anything but a single credential
+// after the scheme, is rejected as malformed.
+func ParseAuthHeader(headers http.Header) (string, string, error) {
+    values := headers.Values("Authorization")
+    if len(values) == 0 {
+        return "", "", ErrNoAuthHeader
+    }
+    if len(values) > 1 {
+        return "", "", ErrMalformedAuthHeader
+    }
+
+    scheme, credentials, found := strings.Cut(strings.TrimSpace(values[0]), " ")
+    credentials = strings.TrimLeft(credentials, " ")
+    if !found || !isToken(scheme) || len(credentials) == 0 {
+        return "", "", ErrMalformedAuthHeader
+    }
+    if strings.ContainsAny(credentials, " \t\r\n") {
+        return "", "", ErrMalformedAuthHeader
+    }
+    return scheme, credentials, nil
+}
+
+// GetAuthToken returns the credentials if the header uses scheme.
+func GetAuthToken(headers http.Header, scheme string) (string, error) {
+    got, credentials, err := ParseAuthHeader(headers)
+    if err != nil {
+        return "", err
+    }
+    if !strings.EqualFold(got, scheme) {
+        return "", ErrWrongAuthScheme
+    }
+    return credentials, nil
+}
+
+func GetBearerToken(headers http.Header) (string, error) {
+    return GetAuthToken(headers, SchemeBearer)
+}
+
+func GetAPIKey(headers http.Header) (string, error) {
+    return GetAuthToken(headers, SchemeAPIKey)
+}
+
+// isToken checks for the RFC 9110 token characters a scheme is made of
+func isToken(s string) bool {
+    if len(s) == 0 {
+        return false
+    }
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+        case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+        default:
+            return false
+        }
+    }
+    return true
+}
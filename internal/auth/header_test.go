@@ -0,0 +1,126 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/trice/Chirpy/internal/auth"
+)
+
+func TestGetAuthToken(t *testing.T) {
+    tests := []struct {
+        name        string
+        headers     []string
+        scheme      string
+        expected    string
+        expectError error
+    }{
+        {
+            name:     "Bearer",
+            headers:  []string{ "Bearer abc123" },
+            scheme:   auth.SchemeBearer,
+            expected: "abc123",
+        },
+        {
+            name:     "Lower case scheme",
+            headers:  []string{ "bearer abc123" },
+            scheme:   auth.SchemeBearer,
+            expected: "abc123",
+        },
+        {
+            name:     "ApiKey",
+            headers:  []string{ "ApiKey f271c81ff7084ee5b99a5091b42d486e" },
+            scheme:   auth.SchemeAPIKey,
+            expected: "f271c81ff7084ee5b99a5091b42d486e",
+        },
+        {
+            name:        "Missing",
+            scheme:      auth.SchemeBearer,
+            expectError: auth.ErrNoAuthHeader,
+        },
+        {
+            name:        "Too short to slice",
+            headers:     []string{ "Bear" },
+            scheme:      auth.SchemeBearer,
+            expectError: auth.ErrMalformedAuthHeader,
+        },
+        {
+            name:        "Scheme only",
+            headers:     []string{ "Bearer " },
+            scheme:      auth.SchemeBearer,
+            expectError: auth.ErrMalformedAuthHeader,
+        },
+        {
+            name:        "Two credentials",
+            headers:     []string{ "Bearer abc 123" },
+            scheme:      auth.SchemeBearer,
+            expectError: auth.ErrMalformedAuthHeader,
+        },
+        {
+            name:        "Two headers",
+            headers:     []string{ "Bearer abc", "Bearer 123" },
+            scheme:      auth.SchemeBearer,
+            expectError: auth.ErrMalformedAuthHeader,
+        },
+        {
+            name:        "Wrong scheme",
+            headers:     []string{ "ApiKey abc123" },
+            scheme:      auth.SchemeBearer,
+            expectError: auth.ErrWrongAuthScheme,
+        },
+        {
+            name:        "Prefix of scheme",
+            headers:     []string{ "Bearerx abc123" },
+            scheme:      auth.SchemeBearer,
+            expectError: auth.ErrWrongAuthScheme,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            headers := http.Header{}
+            for _, h := range tt.headers {
+                headers.Add("Authorization", h)
+            }
+            token, err := auth.GetAuthToken(headers, tt.scheme)
+            if !errors.Is(err, tt.expectError) {
+                t.Errorf("GetAuthToken() error = %v, want %v", err, tt.expectError)
+                return
+            }
+            if token != tt.expected {
+                t.Errorf("GetAuthToken() = %v, want %v", token, tt.expected)
+            }
+        })
+    }
+}
+
+func FuzzParseAuthHeader(f *testing.F) {
+    f.Add("Bearer abc123")
+    f.Add("ApiKey abc123")
+    f.Add("Bearer")
+    f.Add("Bearer ")
+    f.Add("")
+    f.Add(" \t")
+    f.Add("Basic   dXNlcjpwYXNz")
+
+    f.Fuzz(func(t *testing.T, value string) {
+        headers := http.Header{}
+        headers.Set("Authorization", value)
+
+        scheme, credentials, err := auth.ParseAuthHeader(headers)
+        if err != nil {
+            if scheme != "" || credentials != "" {
+                t.Errorf("ParseAuthHeader(%q) returned values with error %v", value, err)
+            }
+            return
+        }
+        if len(scheme) == 0 || len(credentials) == 0 {
+            t.Errorf("ParseAuthHeader(%q) = %q, %q", value, scheme, credentials)
+        }
+        if strings.ContainsAny(scheme + credentials, " \t\r\n") {
+            t.Errorf("ParseAuthHeader(%q) = %q, %q contains whitespace", value, scheme, credentials)
+        }
+    })
+}
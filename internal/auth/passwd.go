@@ -4,7 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -21,7 +21,70 @@ func CheckPasswordHash(password, hash string) error {
     return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+// issuers keep the access token, the short lived MFA challenge token and
+// the re-authentication token from being accepted in place of each other
+const (
+    accessTokenIssuer = "chirpy"
+    mfaTokenIssuer = "chirpy-mfa"
+    reauthTokenIssuer = "chirpy-reauth"
+)
+
+// tokenClaims adds the OAuth scope to the registered claims. First party
+// tokens carry no scope at all and are allowed everything, tokens minted for
+// third party clients only carry what the user granted.
+type tokenClaims struct {
+    jwt.RegisteredClaims
+    Scope string `json:"scope,omitempty"`
+}
+
+// MakeJWT issues an access token for userID. Passing scopes limits the token
+// to those scopes, which is what tokens for third party clients get.
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, scopes ...string) (string, error) {
+    return makeJWT(userID, tokenSecret, expiresIn, accessTokenIssuer, scopes)
+}
+
+// ValidateJWT only accepts unscoped first party access tokens, use
+// ValidateScopedJWT where third party tokens are welcome too.
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+    userID, scopes, err := validateJWT(tokenString, tokenSecret, accessTokenIssuer)
+    if err != nil {
+        return uuid.UUID{}, err
+    }
+    if scopes != nil {
+        return uuid.UUID{}, fmt.Errorf("Scoped token not allowed")
+    }
+    return userID, nil
+}
+
+// ValidateScopedJWT returns the user and the granted scopes. The scopes are
+// nil for first party tokens, see HasScope.
+func ValidateScopedJWT(tokenString, tokenSecret string) (uuid.UUID, []string, error) {
+    return validateJWT(tokenString, tokenSecret, accessTokenIssuer)
+}
+
+// MakeMFAToken issues the token handed out after a correct password when the
+// user still has to present a second factor.
+func MakeMFAToken(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+    return makeJWT(userID, tokenSecret, expiresIn, mfaTokenIssuer, nil)
+}
+
+func ValidateMFAToken(tokenString, tokenSecret string) (uuid.UUID, error) {
+    userID, _, err := validateJWT(tokenString, tokenSecret, mfaTokenIssuer)
+    return userID, err
+}
+
+// MakeReauthToken issues the proof of a sign in that just happened, which
+// accounts without a password show instead of one to change the account.
+func MakeReauthToken(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+    return makeJWT(userID, tokenSecret, expiresIn, reauthTokenIssuer, nil)
+}
+
+func ValidateReauthToken(tokenString, tokenSecret string) (uuid.UUID, error) {
+    userID, _, err := validateJWT(tokenString, tokenSecret, reauthTokenIssuer)
+    return userID, err
+}
+
+func makeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, issuer string, scopes []string) (string, error) {
     if len(tokenSecret) == 0 {
         return "", fmt.Errorf("Invalid tokenSecret")
     }
@@ -30,11 +93,14 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
     issue := jwt.NewNumericDate(now)
     expire := jwt.NewNumericDate(now.Add(expiresIn).UTC())
 
-    claims := jwt.RegisteredClaims {
-        Issuer: "chirpy",
-        IssuedAt: issue,
-        ExpiresAt: expire,
-        Subject: userID.String(),
+    claims := tokenClaims {
+        RegisteredClaims: jwt.RegisteredClaims {
+            Issuer: issuer,
+            IssuedAt: issue,
+            ExpiresAt: expire,
+            Subject: userID.String(),
+        },
+        Scope: strings.Join(scopes, " "),
     }
 
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -42,47 +108,38 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
     return theJwt, err
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+func validateJWT(tokenString, tokenSecret, issuer string) (uuid.UUID, []string, error) {
     if len(tokenSecret) == 0 || tokenSecret == "" {
-        return uuid.UUID{}, fmt.Errorf("Invalid tokenSecret")
+        return uuid.UUID{}, nil, fmt.Errorf("Invalid tokenSecret")
     }
 
     if len(tokenString) == 0 || tokenString == "" {
-        return uuid.UUID{}, fmt.Errorf("Invalid tokenString")
+        return uuid.UUID{}, nil, fmt.Errorf("Invalid tokenString")
     }
 
-    holder := jwt.RegisteredClaims{}
+    holder := tokenClaims{}
 
     token, err := jwt.ParseWithClaims(tokenString, &holder, func(t *jwt.Token) (any, error) {
         return []byte(tokenSecret), nil
-    }, jwt.WithLeeway(5 * time.Second))
+    }, jwt.WithLeeway(5 * time.Second), jwt.WithIssuer(issuer), jwt.WithValidMethods([]string{"HS256"}))
     if err != nil {
-        return uuid.UUID{}, fmt.Errorf("Failed to parse tokenString")
+        return uuid.UUID{}, nil, fmt.Errorf("Failed to parse tokenString")
     }
 
     userId, err := token.Claims.GetSubject()
     if err != nil {
-        return uuid.UUID{}, err
+        return uuid.UUID{}, nil, err
     }
     returnUuid, err := uuid.Parse(userId)
     if err != nil {
-        return uuid.UUID{}, err
+        return uuid.UUID{}, nil, err
     }
 
-    return returnUuid, nil
-}
-
-func GetBearerToken(headers http.Header) (string, error) {
-    tmp := headers.Values("Authorization")
-    if len(tmp) == 0 {
-       return "", fmt.Errorf("Auth no provided")
+    var scopes []string
+    if len(holder.Scope) != 0 {
+        scopes = strings.Fields(holder.Scope)
     }
-
-    bt := tmp[0][7:]
-    if len(bt) == 0 {
-        return "", fmt.Errorf("No token found")
-    }
-    return bt, nil
+    return returnUuid, scopes, nil
 }
 
 func MakeRefreshToken() (string, error) {
@@ -96,3 +153,21 @@ func MakeRefreshToken() (string, error) {
     refreshToken := hex.EncodeToString(tokenBuf)
     return refreshToken, nil
 }
+
+// APIKeyPrefix marks personal API keys so they can be told apart from JWTs
+// without trying to parse them.
+const APIKeyPrefix = "chirpy_pat_"
+
+// MakeAPIKey returns a new personal API key. Only its HashToken digest
+// should ever be stored.
+func MakeAPIKey() (string, error) {
+    key, err := MakeRefreshToken()
+    if err != nil {
+        return "", err
+    }
+    return APIKeyPrefix + key, nil
+}
+
+func IsAPIKey(token string) bool {
+    return strings.HasPrefix(token, APIKeyPrefix)
+}
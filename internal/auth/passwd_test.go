@@ -186,3 +186,50 @@ func TestGetBearerToken(t *testing.T) {
         })
     }
 }
+
+func TestMakeAPIKey(t *testing.T) {
+    key, err := auth.MakeAPIKey()
+    if err != nil {
+        t.Fatalf("MakeAPIKey() error = %v", err)
+    }
+    if !auth.IsAPIKey(key) {
+        t.Errorf("IsAPIKey(%v) = false", key)
+    }
+
+    jwtToken, _ := auth.MakeJWT(uuid.New(), "test-secret", time.Hour)
+    if auth.IsAPIKey(jwtToken) {
+        t.Errorf("IsAPIKey() mistook a JWT for an API key")
+    }
+}
+
+func TestReauthTokenIsOnlyAReauthToken(t *testing.T) {
+    userID := uuid.New()
+    tokenSecret := "test-secret"
+
+    reauthToken, err := auth.MakeReauthToken(userID, tokenSecret, time.Minute)
+    if err != nil {
+        t.Fatalf("MakeReauthToken() error = %v", err)
+    }
+    gotID, err := auth.ValidateReauthToken(reauthToken, tokenSecret)
+    if err != nil || gotID != userID {
+        t.Errorf("ValidateReauthToken() = %v, %v, want %v", gotID, err, userID)
+    }
+
+    _, err = auth.ValidateJWT(reauthToken, tokenSecret)
+    if err == nil {
+        t.Errorf("ValidateJWT() accepted a reauth token")
+    }
+    _, err = auth.ValidateMFAToken(reauthToken, tokenSecret)
+    if err == nil {
+        t.Errorf("ValidateMFAToken() accepted a reauth token")
+    }
+
+    accessToken, err := auth.MakeJWT(userID, tokenSecret, time.Minute)
+    if err != nil {
+        t.Fatalf("MakeJWT() error = %v", err)
+    }
+    _, err = auth.ValidateReauthToken(accessToken, tokenSecret)
+    if err == nil {
+        t.Errorf("ValidateReauthToken() accepted an access token")
+    }
+}
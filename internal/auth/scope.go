@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scopes third party clients can ask for. Reading chirps needs no token at
+// all, so there is no scope for it.
+const (
+    ScopeChirpsWrite = "chirps:write"
+)
+
+var knownScopes = []string{ ScopeChirpsWrite }
+
+// ParseScopes splits a space separated scope string and rejects anything
+// Chirpy doesn't know about. Duplicates are dropped.
+func ParseScopes(scope string) ([]string, error) {
+    scopes := []string{}
+    for _, s := range strings.Fields(scope) {
+        if !slices.Contains(knownScopes, s) {
+            return nil, fmt.Errorf("Unknown scope %q", s)
+        }
+        if !slices.Contains(scopes, s) {
+            scopes = append(scopes, s)
+        }
+    }
+    if len(scopes) == 0 {
+        return nil, fmt.Errorf("No scope requested")
+    }
+    return scopes, nil
+}
+
+// HasScope reports if granted allows want. A nil granted list is a first
+// party token, which is allowed everything.
+func HasScope(granted []string, want string) bool {
+    if granted == nil {
+        return true
+    }
+    return slices.Contains(granted, want)
+}
+
+// VerifyPKCE checks a code_verifier against the S256 code_challenge sent with
+// the authorization request.
+func VerifyPKCE(verifier, challenge string) bool {
+    // RFC 7636 verifiers are 43 to 128 characters
+    if len(verifier) < 43 || len(verifier) > 128 {
+        return false
+    }
+    sum := sha256.Sum256([]byte(verifier))
+    computed := base64.RawURLEncoding.EncodeToString(sum[:])
+    return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,102 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/auth"
+)
+
+func TestScopedJWT(t *testing.T) {
+    userID := uuid.New()
+    tokenSecret := "test-secret"
+
+    scoped, err := auth.MakeJWT(userID, tokenSecret, time.Hour, auth.ScopeChirpsWrite)
+    if err != nil {
+        t.Fatalf("MakeJWT() error = %v", err)
+    }
+
+    gotID, scopes, err := auth.ValidateScopedJWT(scoped, tokenSecret)
+    if err != nil || gotID != userID {
+        t.Fatalf("ValidateScopedJWT() = %v, %v, want %v", gotID, err, userID)
+    }
+    if !auth.HasScope(scopes, auth.ScopeChirpsWrite) || auth.HasScope(scopes, "admin") {
+        t.Errorf("ValidateScopedJWT() scopes = %v", scopes)
+    }
+
+    // account management only takes first party tokens
+    _, err = auth.ValidateJWT(scoped, tokenSecret)
+    if err == nil {
+        t.Errorf("ValidateJWT() accepted a scoped token")
+    }
+
+    firstParty, _ := auth.MakeJWT(userID, tokenSecret, time.Hour)
+    _, scopes, err = auth.ValidateScopedJWT(firstParty, tokenSecret)
+    if err != nil || !auth.HasScope(scopes, auth.ScopeChirpsWrite) {
+        t.Errorf("first party token should have every scope, got %v, %v", scopes, err)
+    }
+}
+
+func TestParseScopes(t *testing.T) {
+    tests := []struct {
+        name        string
+        scope       string
+        expected    int
+        expectError bool
+    }{
+        {
+            name:        "Write scope",
+            scope:       "chirps:write",
+            expected:    1,
+            expectError: false,
+        },
+        {
+            name:        "Duplicates",
+            scope:       "chirps:write  chirps:write",
+            expected:    1,
+            expectError: false,
+        },
+        {
+            name:        "Unknown scope",
+            scope:       "chirps:write admin",
+            expectError: true,
+        },
+        {
+            name:        "Read is public, not a scope",
+            scope:       "chirps:read",
+            expectError: true,
+        },
+        {
+            name:        "Empty",
+            scope:       "",
+            expectError: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            scopes, err := auth.ParseScopes(tt.scope)
+            if (err != nil) != tt.expectError {
+                t.Errorf("ParseScopes() error = %v, expectError %v", err, tt.expectError)
+                return
+            }
+            if !tt.expectError && len(scopes) != tt.expected {
+                t.Errorf("ParseScopes() = %v, want %d scopes", scopes, tt.expected)
+            }
+        })
+    }
+}
+
+func TestVerifyPKCE(t *testing.T) {
+    // RFC 7636 appendix B
+    verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+    challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+    if !auth.VerifyPKCE(verifier, challenge) {
+        t.Errorf("VerifyPKCE() rejected the RFC example")
+    }
+    if auth.VerifyPKCE(verifier[:42], challenge) {
+        t.Errorf("VerifyPKCE() accepted a short verifier")
+    }
+}
@@ -0,0 +1,132 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/auth"
+)
+
+func TestValidateTOTP(t *testing.T) {
+    // RFC 6238 appendix B secret, "12345678901234567890" in base32
+    secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+    tests := []struct {
+        name        string
+        code        string
+        now         time.Time
+        expectError bool
+    }{
+        {
+            name:        "RFC vector 59",
+            code:        "287082",
+            now:         time.Unix(59, 0),
+            expectError: false,
+        },
+        {
+            name:        "RFC vector 1111111109",
+            code:        "081804",
+            now:         time.Unix(1111111109, 0),
+            expectError: false,
+        },
+        {
+            name:        "RFC vector 1234567890",
+            code:        "005924",
+            now:         time.Unix(1234567890, 0),
+            expectError: false,
+        },
+        {
+            name:        "One step of skew",
+            code:        "005924",
+            now:         time.Unix(1234567890 + 30, 0),
+            expectError: false,
+        },
+        {
+            name:        "Too old",
+            code:        "005924",
+            now:         time.Unix(1234567890 + 90, 0),
+            expectError: true,
+        },
+        {
+            name:        "Wrong code",
+            code:        "000000",
+            now:         time.Unix(59, 0),
+            expectError: true,
+        },
+        {
+            name:        "Short code",
+            code:        "28708",
+            now:         time.Unix(59, 0),
+            expectError: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := auth.ValidateTOTP(secret, tt.code, tt.now)
+            if (err != nil) != tt.expectError {
+                t.Errorf("ValidateTOTP() error = %v, expectError %v", err, tt.expectError)
+            }
+        })
+    }
+}
+
+func TestTOTPURI(t *testing.T) {
+    secret, err := auth.MakeTOTPSecret()
+    if err != nil {
+        t.Fatalf("MakeTOTPSecret() error = %v", err)
+    }
+
+    uri := auth.TOTPURI("Chirpy", "walt@breakingbad.com", secret)
+    if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:walt@breakingbad.com?") {
+        t.Errorf("Unexpected URI: %v", uri)
+    }
+    if !strings.Contains(uri, "secret=" + secret) {
+        t.Errorf("URI is missing the secret: %v", uri)
+    }
+}
+
+func TestMFATokenIsNotAnAccessToken(t *testing.T) {
+    userID := uuid.New()
+    tokenSecret := "test-secret"
+
+    mfaToken, err := auth.MakeMFAToken(userID, tokenSecret, time.Minute)
+    if err != nil {
+        t.Fatalf("MakeMFAToken() error = %v", err)
+    }
+
+    gotID, err := auth.ValidateMFAToken(mfaToken, tokenSecret)
+    if err != nil || gotID != userID {
+        t.Errorf("ValidateMFAToken() = %v, %v, want %v", gotID, err, userID)
+    }
+
+    _, err = auth.ValidateJWT(mfaToken, tokenSecret)
+    if err == nil {
+        t.Errorf("ValidateJWT() accepted an MFA token")
+    }
+}
+
+func TestMakeRecoveryCodes(t *testing.T) {
+    codes, err := auth.MakeRecoveryCodes(10)
+    if err != nil {
+        t.Fatalf("MakeRecoveryCodes() error = %v", err)
+    }
+    if len(codes) != 10 {
+        t.Fatalf("MakeRecoveryCodes() made %d codes, want 10", len(codes))
+    }
+
+    seen := map[string]bool{}
+    for _, code := range codes {
+        groups := strings.Split(code, "-")
+        // 4 groups of 5 hex digits is 80 bits
+        if len(groups) != 4 || len(strings.Join(groups, "")) != 20 {
+            t.Errorf("code %q isn't xxxxx-xxxxx-xxxxx-xxxxx", code)
+        }
+        if seen[code] {
+            t.Errorf("code %q was made twice", code)
+        }
+        seen[code] = true
+    }
+}
@@ -0,0 +1,313 @@
+// Package config loads Chirpy's settings. Every setting has a default and
+// can be set, from lowest to highest precedence, in a TOML config file, in
+// the environment (which includes .env, see godotenv) and with a command
+// line flag named after its key, e.g. -server.port 9000.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is every setting Chirpy reads at startup. The env tag names the
+// environment variable, key the config file key and flag.
+type Config struct {
+    Platform string `env:"PLATFORM" key:"platform" help:"dev turns on the admin reset endpoint and insecure cookies"`
+    DevFixtures string `env:"DEV_FIXTURES" key:"dev.fixtures" help:"fixtures the dev reset loads after wiping the database, empty loads none"`
+
+    DatabaseURL string `env:"DB_URL" key:"database.url" help:"Postgres connection string"`
+    AutoMigrate bool `env:"AUTO_MIGRATE" key:"database.auto_migrate" help:"apply pending migrations on start"`
+    SlowQueryThreshold time.Duration `env:"SLOW_QUERY_THRESHOLD" key:"database.slow_query_threshold" help:"log queries slower than this, 0 to turn off"`
+
+    Port int `env:"PORT" key:"server.port" help:"port to listen on"`
+    ReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT" key:"server.read_header_timeout" help:"time allowed to read request headers"`
+    ReadTimeout time.Duration `env:"HTTP_READ_TIMEOUT" key:"server.read_timeout" help:"time allowed to read a whole request"`
+    WriteTimeout time.Duration `env:"HTTP_WRITE_TIMEOUT" key:"server.write_timeout" help:"time allowed to write a response"`
+    IdleTimeout time.Duration `env:"HTTP_IDLE_TIMEOUT" key:"server.idle_timeout" help:"how long idle keep-alive connections stay open"`
+    ShutdownDelay time.Duration `env:"SHUTDOWN_DELAY" key:"server.shutdown_delay" help:"how long readiness fails before the listener closes on shutdown"`
+    ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" key:"server.shutdown_timeout" help:"how long in flight requests get to finish on shutdown"`
+    TrustProxy bool `env:"TRUST_PROXY" key:"server.trust_proxy" help:"take the client IP from X-Forwarded-For"`
+
+    Secret string `env:"SECRET" key:"auth.secret" help:"JWT signing secret"`
+    AccessTokenTTL time.Duration `env:"ACCESS_TOKEN_TTL" key:"auth.access_token_ttl" help:"lifetime of access tokens"`
+    RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" key:"auth.refresh_token_ttl" help:"lifetime of refresh tokens"`
+    DeletionGrace time.Duration `env:"ACCOUNT_DELETION_GRACE" key:"auth.deletion_grace" help:"how long a deleted account can still be restored"`
+    AdminKey string `env:"ADMIN_KEY" key:"auth.admin_key" help:"API key for the /admin endpoints, empty turns them off"`
+
+    PolkaKey string `env:"POLKA_KEY" key:"polka.key" help:"secret Polka signs webhooks with"`
+
+    ExportTTL time.Duration `env:"EXPORT_TTL" key:"exports.ttl" help:"how long a finished data export can be downloaded"`
+
+    ChirpMaxLength int `env:"CHIRP_MAX_LENGTH" key:"chirps.max_length" help:"longest chirp on the free plan"`
+    RedChirpMaxLength int `env:"CHIRP_MAX_LENGTH_RED" key:"chirps.red_max_length" help:"longest chirp for Chirpy Red members"`
+
+    RateLimitBackend string `env:"RATE_LIMIT_BACKEND" key:"rate_limits.backend" help:"memory or postgres"`
+    RateLimits string `env:"RATE_LIMITS" key:"rate_limits.limits" help:"overrides like login=5/m,chirps=100/h"`
+
+    SMTPAddr string `env:"SMTP_ADDR" key:"mail.smtp_addr" help:"SMTP server, empty logs mail instead"`
+    MailFrom string `env:"MAIL_FROM" key:"mail.from" help:"sender address"`
+    SMTPUsername string `env:"SMTP_USERNAME" key:"mail.smtp_username" help:"SMTP user"`
+    SMTPPassword string `env:"SMTP_PASSWORD" key:"mail.smtp_password" help:"SMTP password"`
+
+    LogFormat string `env:"LOG_FORMAT" key:"log.format" help:"json or text"`
+    LogLevel string `env:"LOG_LEVEL" key:"log.level" help:"debug, info, warn or error"`
+}
+
+// Default returns the settings used when nothing else is given.
+func Default() Config {
+    return Config {
+        Platform: "production",
+        DevFixtures: "fixtures/dev.json",
+        SlowQueryThreshold: 200 * time.Millisecond,
+        Port: 8080,
+        ReadHeaderTimeout: 5 * time.Second,
+        ReadTimeout: 15 * time.Second,
+        WriteTimeout: 30 * time.Second,
+        IdleTimeout: 2 * time.Minute,
+        ShutdownTimeout: 30 * time.Second,
+        AccessTokenTTL: time.Hour,
+        RefreshTokenTTL: 60 * 24 * time.Hour,
+        DeletionGrace: 30 * 24 * time.Hour,
+        ExportTTL: 7 * 24 * time.Hour,
+        ChirpMaxLength: 140,
+        RedChirpMaxLength: 560,
+        RateLimitBackend: "memory",
+        LogFormat: "json",
+        LogLevel: "info",
+    }
+}
+
+func (c Config) IsDev() bool {
+    return c.Platform == "dev"
+}
+
+func (c Config) Addr() string {
+    return ":" + strconv.Itoa(c.Port)
+}
+
+// ConfigFileEnv names the config file when there is no -config flag.
+const ConfigFileEnv = "CHIRPY_CONFIG"
+
+// Load builds the config from args, the command line without the program
+// name, and lookupEnv, normally os.LookupEnv. It also returns the arguments
+// left after the flags, and flag.ErrHelp when asked for -h. Call Validate
+// before serving with it.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, []string, error) {
+    cfg := Default()
+    fields := settings(&cfg)
+
+    fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+    configFile := fs.String("config", "", "TOML config file, defaults to $" + ConfigFileEnv)
+    flagValues := map[string]*string{}
+    for _, f := range fields {
+        flagValues[f.key] = fs.String(f.key, "", f.help + " ($" + f.env + ")")
+    }
+    err := fs.Parse(args)
+    if err != nil {
+        return Config{}, nil, err
+    }
+
+    path := *configFile
+    if len(path) == 0 {
+        path, _ = lookupEnv(ConfigFileEnv)
+    }
+    if len(path) != 0 {
+        values, err := readFile(path)
+        if err != nil {
+            return Config{}, nil, err
+        }
+        for key, value := range values {
+            f, ok := fields[key]
+            if !ok {
+                return Config{}, nil, fmt.Errorf("%s: unknown setting %q", path, key)
+            }
+            err = f.set(value)
+            if err != nil {
+                return Config{}, nil, fmt.Errorf("%s: %w", path, err)
+            }
+        }
+    }
+
+    for _, f := range fields {
+        value, ok := lookupEnv(f.env)
+        if !ok || len(value) == 0 {
+            continue
+        }
+        err = f.set(value)
+        if err != nil {
+            return Config{}, nil, fmt.Errorf("$%s: %w", f.env, err)
+        }
+    }
+
+    // only flags that were actually passed win over the rest
+    fs.Visit(func(fl *flag.Flag) {
+        f, ok := fields[fl.Name]
+        if ok && err == nil {
+            err = f.set(*flagValues[fl.Name])
+        }
+    })
+    if err != nil {
+        return Config{}, nil, fmt.Errorf("-%w", err)
+    }
+
+    return cfg, fs.Args(), nil
+}
+
+// Validate reports every setting that is missing or makes no sense.
+func (c Config) Validate() error {
+    errs := []error{}
+    if len(c.DatabaseURL) == 0 {
+        errs = append(errs, errors.New("database.url ($DB_URL) is required"))
+    }
+    if len(c.Secret) == 0 && !c.IsDev() {
+        errs = append(errs, errors.New("auth.secret ($SECRET) is required outside of dev"))
+    }
+    if c.Port <= 0 || c.Port > 65535 {
+        errs = append(errs, fmt.Errorf("server.port %d is not a port", c.Port))
+    }
+    if c.ShutdownDelay < 0 || c.ShutdownTimeout < 0 {
+        errs = append(errs, errors.New("shutdown durations can't be negative"))
+    }
+    if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 {
+        errs = append(errs, errors.New("token lifetimes must be positive"))
+    }
+    if c.ChirpMaxLength <= 0 || c.RedChirpMaxLength < c.ChirpMaxLength {
+        errs = append(errs, errors.New("chirps.max_length must be positive and no more than chirps.red_max_length"))
+    }
+    if c.RateLimitBackend != "memory" && c.RateLimitBackend != "postgres" {
+        errs = append(errs, fmt.Errorf("rate_limits.backend %q is not memory or postgres", c.RateLimitBackend))
+    }
+    if c.LogFormat != "json" && c.LogFormat != "text" {
+        errs = append(errs, fmt.Errorf("log.format %q is not json or text", c.LogFormat))
+    }
+    return errors.Join(errs...)
+}
+
+// setting is one field of Config
+type setting struct {
+    key string
+    env string
+    help string
+    value reflect.Value
+}
+
+func settings(cfg *Config) map[string]setting {
+    out := map[string]setting{}
+    v := reflect.ValueOf(cfg).Elem()
+    for i := 0; i < v.NumField(); i++ {
+        field := v.Type().Field(i)
+        s := setting {
+            key: field.Tag.Get("key"),
+            env: field.Tag.Get("env"),
+            help: field.Tag.Get("help"),
+            value: v.Field(i),
+        }
+        out[s.key] = s
+    }
+    return out
+}
+
+func (s setting) set(raw string) error {
+    switch s.value.Interface().(type) {
+    case string:
+        s.value.SetString(raw)
+    case bool:
+        b, err := strconv.ParseBool(raw)
+        if err != nil {
+            return fmt.Errorf("%s: %q is not true or false", s.key, raw)
+        }
+        s.value.SetBool(b)
+    case int:
+        n, err := strconv.Atoi(raw)
+        if err != nil {
+            return fmt.Errorf("%s: %q is not a number", s.key, raw)
+        }
+        s.value.SetInt(int64(n))
+    case time.Duration:
+        d, err := time.ParseDuration(raw)
+        if err != nil {
+            return fmt.Errorf("%s: %q is not a duration like 30s", s.key, raw)
+        }
+        s.value.SetInt(int64(d))
+    default:
+        panic("config: unsupported type for " + s.key)
+    }
+    return nil
+}
+
+// readFile reads the subset of TOML Chirpy needs: [tables] and key = value
+// pairs with string, integer or boolean values.
+func readFile(path string) (map[string]string, error) {
+    d, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return parseTOML(path, string(d))
+}
+
+func parseTOML(path, text string) (map[string]string, error) {
+    values := map[string]string{}
+    table := ""
+    for n, line := range strings.Split(text, "\n") {
+        line = strings.TrimSpace(stripComment(line))
+        if len(line) == 0 {
+            continue
+        }
+
+        if strings.HasPrefix(line, "[") {
+            if !strings.HasSuffix(line, "]") {
+                return nil, fmt.Errorf("%s:%d: bad table header", path, n + 1)
+            }
+            table = strings.TrimSpace(line[1:len(line) - 1]) + "."
+            continue
+        }
+
+        key, raw, ok := strings.Cut(line, "=")
+        if !ok {
+            return nil, fmt.Errorf("%s:%d: expected key = value", path, n + 1)
+        }
+        key = table + strings.TrimSpace(key)
+        raw = strings.TrimSpace(raw)
+
+        value := raw
+        if strings.HasPrefix(raw, `"`) {
+            var err error
+            value, err = strconv.Unquote(raw)
+            if err != nil {
+                return nil, fmt.Errorf("%s:%d: bad string %s", path, n + 1, raw)
+            }
+        } else if strings.HasPrefix(raw, "'") && strings.HasSuffix(raw, "'") && len(raw) >= 2 {
+            value = raw[1:len(raw) - 1]
+        }
+        if _, dup := values[key]; dup {
+            return nil, fmt.Errorf("%s:%d: %s is set twice", path, n + 1, key)
+        }
+        values[key] = value
+    }
+    return values, nil
+}
+
+// stripComment drops a # comment that isn't inside a string
+func stripComment(line string) string {
+    var quote byte
+    for i := 0; i < len(line); i++ {
+        c := line[i]
+        switch {
+        case quote != 0 && c == '\\' && quote == '"':
+            i++
+        case quote != 0 && c == quote:
+            quote = 0
+        case quote == 0 && (c == '"' || c == '\''):
+            quote = c
+        case quote == 0 && c == '#':
+            return line[:i]
+        }
+    }
+    return line
+}
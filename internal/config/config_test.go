@@ -0,0 +1,148 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trice/Chirpy/internal/config"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+    return func(name string) (string, bool) {
+        v, ok := vars[name]
+        return v, ok
+    }
+}
+
+func writeFile(t *testing.T, text string) string {
+    path := filepath.Join(t.TempDir(), "chirpy.toml")
+    err := os.WriteFile(path, []byte(text), 0o600)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+    path := writeFile(t, `
+# settings shared by every instance
+platform = "dev"
+
+[server]
+port = 9000
+read_timeout = "20s"   # longer uploads
+
+[chirps]
+max_length = 200
+`)
+
+    vars := map[string]string {
+        "DB_URL": "postgres://localhost/chirpy",
+        "PORT": "9100",
+        config.ConfigFileEnv: path,
+    }
+    cfg, args, err := config.Load([]string{ "-server.port", "9200", "migrate", "up" }, env(vars))
+    if err != nil {
+        t.Fatalf("Load() error = %v", err)
+    }
+    if len(args) != 2 || args[0] != "migrate" {
+        t.Errorf("args = %q, want the command after the flags", args)
+    }
+
+    if cfg.Port != 9200 {
+        t.Errorf("Port = %d, the flag should win", cfg.Port)
+    }
+    if cfg.ReadTimeout != 20 * time.Second {
+        t.Errorf("ReadTimeout = %v, want the file's 20s", cfg.ReadTimeout)
+    }
+    if cfg.ChirpMaxLength != 200 || cfg.RedChirpMaxLength != 560 {
+        t.Errorf("chirp lengths = %d/%d", cfg.ChirpMaxLength, cfg.RedChirpMaxLength)
+    }
+    if !cfg.IsDev() || cfg.DatabaseURL != vars["DB_URL"] {
+        t.Errorf("cfg = %+v", cfg)
+    }
+    if cfg.RefreshTokenTTL != 60 * 24 * time.Hour {
+        t.Errorf("RefreshTokenTTL = %v, want the default", cfg.RefreshTokenTTL)
+    }
+
+    // without the flag the environment beats the file
+    cfg, _, err = config.Load(nil, env(vars))
+    if err != nil || cfg.Port != 9100 {
+        t.Errorf("Port = %d, err = %v, want 9100 from the environment", cfg.Port, err)
+    }
+}
+
+func TestLoadErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        args []string
+        vars map[string]string
+        file string
+        want string
+    }{
+        {
+            name: "No secret in production",
+            vars: map[string]string{ "DB_URL": "postgres://db" },
+            want: "auth.secret",
+        },
+        {
+            name: "No database",
+            vars: map[string]string{ "SECRET": "s", "PLATFORM": "dev" },
+            want: "database.url",
+        },
+        {
+            name: "Bad duration",
+            vars: map[string]string{ "DB_URL": "postgres://db", "SECRET": "s", "ACCESS_TOKEN_TTL": "an hour" },
+            want: "ACCESS_TOKEN_TTL",
+        },
+        {
+            name: "Bad flag value",
+            args: []string{ "-server.port", "http" },
+            vars: map[string]string{ "DB_URL": "postgres://db", "SECRET": "s" },
+            want: "server.port",
+        },
+        {
+            name: "Typo in file",
+            vars: map[string]string{ "DB_URL": "postgres://db", "SECRET": "s" },
+            file: "[server]\nprot = 80\n",
+            want: `unknown setting "server.prot"`,
+        },
+        {
+            name: "Unknown backend",
+            vars: map[string]string{ "DB_URL": "postgres://db", "SECRET": "s", "RATE_LIMIT_BACKEND": "redis" },
+            want: "rate_limits.backend",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            args := tt.args
+            if len(tt.file) != 0 {
+                args = append([]string{ "-config", writeFile(t, tt.file) }, args...)
+            }
+            cfg, _, err := config.Load(args, env(tt.vars))
+            if err == nil {
+                err = cfg.Validate()
+            }
+            if err == nil || !strings.Contains(err.Error(), tt.want) {
+                t.Errorf("Load() error = %v, want it to mention %q", err, tt.want)
+            }
+        })
+    }
+}
+
+func TestLoadHelp(t *testing.T) {
+    stderr := os.Stderr
+    os.Stderr, _ = os.Open(os.DevNull)
+    defer func() { os.Stderr = stderr }()
+
+    _, _, err := config.Load([]string{ "-h" }, env(nil))
+    if !errors.Is(err, flag.ErrHelp) {
+        t.Errorf("Load(-h) error = %v", err)
+    }
+}
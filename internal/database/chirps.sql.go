@@ -7,29 +7,87 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countChirpsByUserWithin = `-- name: CountChirpsByUserWithin :one
+SELECT COUNT(*)
+FROM chirps
+WHERE user_id=$1 AND created_at > NOW() - make_interval(secs => $2::float8)
+`
+
+type CountChirpsByUserWithinParams struct {
+	UserID     uuid.UUID `json:"user_id"`
+	WindowSecs float64   `json:"window_secs"`
+}
+
+// chirps from the last window_secs seconds
+func (q *Queries) CountChirpsByUserWithin(ctx context.Context, arg CountChirpsByUserWithinParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUserWithin, arg.UserID, arg.WindowSecs)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    COALESCE($3, NOW())
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, publish_at
 `
 
 type CreateChirpParams struct {
-	Body   string    `json:"body"`
-	UserID uuid.UUID `json:"user_id"`
+	Body      string       `json:"body"`
+	UserID    uuid.UUID    `json:"user_id"`
+	PublishAt sql.NullTime `json:"publish_at"`
 }
 
+// publish_at is only set for scheduled chirps, everything else goes out on
+// the database's clock
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.PublishAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+	)
+	return i, err
+}
+
+const createChirpAt = `-- name: CreateChirpAt :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $1,
+    $2,
+    $3,
+    $1
+)
+RETURNING id, created_at, updated_at, body, user_id, publish_at
+`
+
+type CreateChirpAtParams struct {
+	CreatedAt time.Time `json:"created_at"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) CreateChirpAt(ctx context.Context, arg CreateChirpAtParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createChirpAt, arg.CreatedAt, arg.Body, arg.UserID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +95,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
 	)
 	return i, err
 }
@@ -47,8 +106,8 @@ DELETE FROM chirps
 `
 
 type DeleteChirpForUserParams struct {
-	ID     uuid.NullUUID `json:"id"`
-	UserID uuid.UUID     `json:"user_id"`
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
 }
 
 func (q *Queries) DeleteChirpForUser(ctx context.Context, arg DeleteChirpForUserParams) error {
@@ -56,13 +115,27 @@ func (q *Queries) DeleteChirpForUser(ctx context.Context, arg DeleteChirpForUser
 	return err
 }
 
+const deleteChirpsByUser = `-- name: DeleteChirpsByUser :execrows
+DELETE FROM chirps
+    WHERE user_id=$1
+`
+
+func (q *Queries) DeleteChirpsByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirpsByUser, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getChirpById = `-- name: GetChirpById :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, publish_at
 FROM chirps
 WHERE id = $1
+    AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deleted_at IS NULL)
 `
 
-func (q *Queries) GetChirpById(ctx context.Context, id uuid.NullUUID) (Chirp, error) {
+func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error) {
 	row := q.db.QueryRowContext(ctx, getChirpById, id)
 	var i Chirp
 	err := row.Scan(
@@ -71,14 +144,17 @@ func (q *Queries) GetChirpById(ctx context.Context, id uuid.NullUUID) (Chirp, er
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, publish_at
 FROM chirps
-ORDER BY created_at ASC
+WHERE publish_at <= NOW()
+    AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deleted_at IS NULL)
+ORDER BY publish_at ASC
 `
 
 func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
@@ -96,6 +172,7 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
@@ -111,10 +188,11 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByAuthor = `-- name: GetChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, publish_at
 FROM chirps
-WHERE user_id=$1
-ORDER BY created_at ASC
+WHERE user_id=$1 AND publish_at <= NOW()
+    AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deleted_at IS NULL)
+ORDER BY publish_at ASC
 `
 
 func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
@@ -132,6 +210,66 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPublishedChirpById = `-- name: GetPublishedChirpById :one
+SELECT id, created_at, updated_at, body, user_id, publish_at
+FROM chirps
+WHERE id = $1 AND publish_at <= NOW()
+    AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deleted_at IS NULL)
+`
+
+// like GetChirpById, but scheduled chirps aren't found until they go out
+func (q *Queries) GetPublishedChirpById(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getPublishedChirpById, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+	)
+	return i, err
+}
+
+const listChirpsForUser = `-- name: ListChirpsForUser :many
+SELECT id, created_at, updated_at, body, user_id, publish_at
+FROM chirps
+WHERE user_id=$1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListChirpsForUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
@@ -145,3 +283,31 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const updateChirpForUser = `-- name: UpdateChirpForUser :one
+UPDATE chirps
+    SET body=$3,
+    updated_at=NOW()
+    WHERE id=$1 AND user_id=$2
+RETURNING id, created_at, updated_at, body, user_id, publish_at
+`
+
+type UpdateChirpForUserParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Body   string    `json:"body"`
+}
+
+func (q *Queries) UpdateChirpForUser(ctx context.Context, arg UpdateChirpForUserParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpForUser, arg.ID, arg.UserID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+	)
+	return i, err
+}
@@ -1,19 +0,0 @@
-// Code generated by sqlc. DO NOT EDIT.
-// versions:
-//   sqlc v1.29.0
-// source: delete_users.sql
-
-package database
-
-import (
-	"context"
-)
-
-const deleteUser = `-- name: DeleteUser :exec
-DELETE FROM users
-`
-
-func (q *Queries) DeleteUser(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, deleteUser)
-	return err
-}
@@ -8,8 +8,10 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -30,11 +32,11 @@ type CreateUserParams struct {
 }
 
 type CreateUserRow struct {
-	ID          uuid.NullUUID `json:"id"`
-	CreatedAt   sql.NullTime  `json:"created_at"`
-	UpdatedAt   sql.NullTime  `json:"updated_at"`
-	Email       string        `json:"email"`
-	IsChirpyRed bool          `json:"is_chirpy_red"`
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
@@ -50,8 +52,105 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 	return i, err
 }
 
+const createUserAt = `-- name: CreateUserAt :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $1,
+    $2,
+    $3
+)
+RETURNING id, created_at, updated_at, email, is_chirpy_red
+`
+
+type CreateUserAtParams struct {
+	CreatedAt      time.Time `json:"created_at"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+}
+
+type CreateUserAtRow struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+func (q *Queries) CreateUserAt(ctx context.Context, arg CreateUserAtParams) (CreateUserAtRow, error) {
+	row := q.db.QueryRowContext(ctx, createUserAt, arg.CreatedAt, arg.Email, arg.HashedPassword)
+	var i CreateUserAtRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.IsChirpyRed,
+	)
+	return i, err
+}
+
+const getPublicProfile = `-- name: GetPublicProfile :one
+SELECT id, username, display_name, bio, avatar_url, created_at
+FROM users
+WHERE id=$1 AND deleted_at IS NULL
+`
+
+type GetPublicProfileRow struct {
+	ID          uuid.UUID      `json:"id"`
+	Username    sql.NullString `json:"username"`
+	DisplayName string         `json:"display_name"`
+	Bio         string         `json:"bio"`
+	AvatarUrl   string         `json:"avatar_url"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+func (q *Queries) GetPublicProfile(ctx context.Context, id uuid.UUID) (GetPublicProfileRow, error) {
+	row := q.db.QueryRowContext(ctx, getPublicProfile, id)
+	var i GetPublicProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getPublicProfileByUsername = `-- name: GetPublicProfileByUsername :one
+SELECT id, username, display_name, bio, avatar_url, created_at
+FROM users
+WHERE lower(username)=lower($1) AND deleted_at IS NULL
+`
+
+type GetPublicProfileByUsernameRow struct {
+	ID          uuid.UUID      `json:"id"`
+	Username    sql.NullString `json:"username"`
+	DisplayName string         `json:"display_name"`
+	Bio         string         `json:"bio"`
+	AvatarUrl   string         `json:"avatar_url"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+func (q *Queries) GetPublicProfileByUsername(ctx context.Context, lower string) (GetPublicProfileByUsernameRow, error) {
+	row := q.db.QueryRowContext(ctx, getPublicProfileByUsername, lower)
+	var i GetPublicProfileByUsernameRow
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email=$1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, disabled_at, deleted_at, username, display_name, bio, avatar_url FROM users WHERE email=$1
 `
 
 func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
@@ -64,6 +163,221 @@ func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.DisabledAt,
+		&i.DeletedAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+	)
+	return i, err
+}
+
+const getUserById = `-- name: GetUserById :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, disabled_at, deleted_at, username, display_name, bio, avatar_url FROM users WHERE id=$1
+`
+
+func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserById, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.DisabledAt,
+		&i.DeletedAt,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+	)
+	return i, err
+}
+
+const listPublicProfiles = `-- name: ListPublicProfiles :many
+SELECT id, username, display_name, bio, avatar_url, created_at
+FROM users
+WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+`
+
+type ListPublicProfilesRow struct {
+	ID          uuid.UUID      `json:"id"`
+	Username    sql.NullString `json:"username"`
+	DisplayName string         `json:"display_name"`
+	Bio         string         `json:"bio"`
+	AvatarUrl   string         `json:"avatar_url"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+func (q *Queries) ListPublicProfiles(ctx context.Context, ids []uuid.UUID) ([]ListPublicProfilesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPublicProfiles, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPublicProfilesRow
+	for rows.Next() {
+		var i ListPublicProfilesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarUrl,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at <= NOW() - make_interval(secs => $1::float8)
+`
+
+// users deleted more than grace_secs seconds ago
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, graceSecs float64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers, graceSecs)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreUser = `-- name: RestoreUser :execrows
+UPDATE users
+SET deleted_at=NULL,
+updated_at=NOW()
+WHERE id=$1 AND deleted_at > NOW() - make_interval(secs => $2::float8)
+`
+
+type RestoreUserParams struct {
+	ID        uuid.UUID `json:"id"`
+	GraceSecs float64   `json:"grace_secs"`
+}
+
+// only users deleted within the last grace_secs seconds
+func (q *Queries) RestoreUser(ctx context.Context, arg RestoreUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, restoreUser, arg.ID, arg.GraceSecs)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserAdmin = `-- name: SetUserAdmin :execrows
+UPDATE users
+SET is_admin=$2,
+updated_at=NOW()
+WHERE id=$1
+`
+
+type SetUserAdminParams struct {
+	ID      uuid.UUID `json:"id"`
+	IsAdmin bool      `json:"is_admin"`
+}
+
+func (q *Queries) SetUserAdmin(ctx context.Context, arg SetUserAdminParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserAdmin, arg.ID, arg.IsAdmin)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserDisabled = `-- name: SetUserDisabled :execrows
+UPDATE users
+SET disabled_at=$2,
+updated_at=NOW()
+WHERE id=$1
+`
+
+type SetUserDisabledParams struct {
+	ID         uuid.UUID    `json:"id"`
+	DisabledAt sql.NullTime `json:"disabled_at"`
+}
+
+func (q *Queries) SetUserDisabled(ctx context.Context, arg SetUserDisabledParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserDisabled, arg.ID, arg.DisabledAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const softDeleteUser = `-- name: SoftDeleteUser :one
+UPDATE users
+SET deleted_at=NOW(),
+updated_at=NOW()
+WHERE id=$1 AND deleted_at IS NULL
+RETURNING deleted_at
+`
+
+func (q *Queries) SoftDeleteUser(ctx context.Context, id uuid.UUID) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, softDeleteUser, id)
+	var deleted_at sql.NullTime
+	err := row.Scan(&deleted_at)
+	return deleted_at, err
+}
+
+const updateProfile = `-- name: UpdateProfile :one
+UPDATE users
+SET username=$2,
+display_name=$3,
+bio=$4,
+avatar_url=$5,
+updated_at=NOW()
+WHERE id=$1
+RETURNING id, username, display_name, bio, avatar_url, created_at
+`
+
+type UpdateProfileParams struct {
+	ID          uuid.UUID      `json:"id"`
+	Username    sql.NullString `json:"username"`
+	DisplayName string         `json:"display_name"`
+	Bio         string         `json:"bio"`
+	AvatarUrl   string         `json:"avatar_url"`
+}
+
+type UpdateProfileRow struct {
+	ID          uuid.UUID      `json:"id"`
+	Username    sql.NullString `json:"username"`
+	DisplayName string         `json:"display_name"`
+	Bio         string         `json:"bio"`
+	AvatarUrl   string         `json:"avatar_url"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+func (q *Queries) UpdateProfile(ctx context.Context, arg UpdateProfileParams) (UpdateProfileRow, error) {
+	row := q.db.QueryRowContext(ctx, updateProfile,
+		arg.ID,
+		arg.Username,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarUrl,
+	)
+	var i UpdateProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.CreatedAt,
 	)
 	return i, err
 }
@@ -76,16 +390,16 @@ RETURNING id, created_at, updated_at, email, is_chirpy_red
 `
 
 type UpdateRedParams struct {
-	IsChirpyRed bool          `json:"is_chirpy_red"`
-	ID          uuid.NullUUID `json:"id"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID          uuid.UUID `json:"id"`
 }
 
 type UpdateRedRow struct {
-	ID          uuid.NullUUID `json:"id"`
-	CreatedAt   sql.NullTime  `json:"created_at"`
-	UpdatedAt   sql.NullTime  `json:"updated_at"`
-	Email       string        `json:"email"`
-	IsChirpyRed bool          `json:"is_chirpy_red"`
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
 }
 
 func (q *Queries) UpdateRed(ctx context.Context, arg UpdateRedParams) (UpdateRedRow, error) {
@@ -111,17 +425,17 @@ RETURNING id, created_at, updated_at, email, is_chirpy_red
 `
 
 type UpdateUserParams struct {
-	Email          string        `json:"email"`
-	HashedPassword string        `json:"hashed_password"`
-	ID             uuid.NullUUID `json:"id"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"hashed_password"`
+	ID             uuid.UUID `json:"id"`
 }
 
 type UpdateUserRow struct {
-	ID          uuid.NullUUID `json:"id"`
-	CreatedAt   sql.NullTime  `json:"created_at"`
-	UpdatedAt   sql.NullTime  `json:"updated_at"`
-	Email       string        `json:"email"`
-	IsChirpyRed bool          `json:"is_chirpy_red"`
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error) {
@@ -0,0 +1,165 @@
+// Package dataexport gathers everything Chirpy stores about a user into a
+// zip archive of JSON files they can download.
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/database"
+)
+
+// Profile is the user row minus the secrets.
+type Profile struct {
+    ID uuid.UUID `json:"id"`
+    Email string `json:"email"`
+    Username string `json:"username"`
+    DisplayName string `json:"display_name"`
+    Bio string `json:"bio"`
+    AvatarURL string `json:"avatar_url"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+    IsChirpyRed bool `json:"is_chirpy_red"`
+    TwoFactorEnabled bool `json:"two_factor_enabled"`
+    Subscription *database.Subscription `json:"subscription"`
+    Identities []database.ListIdentitiesForUserRow `json:"identities"`
+}
+
+type Follows struct {
+    Following []database.ListFollowingRow `json:"following"`
+    Followers []database.ListFollowersRow `json:"followers"`
+}
+
+// Sessions lists where the user is signed in, never the tokens themselves.
+type Sessions struct {
+    RefreshTokens []database.ListRefreshTokensForUserRow `json:"refresh_tokens"`
+    APIKeys []database.ListAPIKeysForUserRow `json:"api_keys"`
+}
+
+type Archive struct {
+    ExportedAt time.Time
+    Profile Profile
+    Chirps []database.Chirp
+    Follows Follows
+    Sessions Sessions
+}
+
+// Collect reads the user's data through q. Pass queries bound to a
+// read only transaction to get a consistent snapshot.
+func Collect(ctx context.Context, q *database.Queries, userID uuid.UUID) (Archive, error) {
+    user, err := q.GetUserById(ctx, userID)
+    if err != nil {
+        return Archive{}, err
+    }
+
+    a := Archive {
+        ExportedAt: time.Now().UTC(),
+        Profile: Profile {
+            ID: user.ID,
+            Email: user.Email,
+            Username: user.Username.String,
+            DisplayName: user.DisplayName,
+            Bio: user.Bio,
+            AvatarURL: user.AvatarUrl,
+            CreatedAt: user.CreatedAt,
+            UpdatedAt: user.UpdatedAt,
+            IsChirpyRed: user.IsChirpyRed,
+        },
+    }
+
+    totp, err := q.GetTOTPForUser(ctx, userID)
+    if err == nil {
+        a.Profile.TwoFactorEnabled = totp.ConfirmedAt.Valid
+    } else if !errors.Is(err, sql.ErrNoRows) {
+        return Archive{}, err
+    }
+
+    sub, err := q.GetSubscriptionForUser(ctx, userID)
+    if err == nil {
+        a.Profile.Subscription = &sub
+    } else if !errors.Is(err, sql.ErrNoRows) {
+        return Archive{}, err
+    }
+
+    a.Profile.Identities, err = q.ListIdentitiesForUser(ctx, userID)
+    if err == nil {
+        a.Chirps, err = q.ListChirpsForUser(ctx, userID)
+    }
+    if err == nil {
+        a.Follows.Following, err = q.ListFollowing(ctx, userID)
+    }
+    if err == nil {
+        a.Follows.Followers, err = q.ListFollowers(ctx, userID)
+    }
+    if err == nil {
+        a.Sessions.RefreshTokens, err = q.ListRefreshTokensForUser(ctx, userID)
+    }
+    if err == nil {
+        a.Sessions.APIKeys, err = q.ListAPIKeysForUser(ctx, userID)
+    }
+    if err != nil {
+        return Archive{}, err
+    }
+    return a, nil
+}
+
+// Zip writes the archive as one JSON file per kind of data. Empty lists come
+// out as [] rather than null.
+func (a Archive) Zip() ([]byte, error) {
+    if a.Profile.Identities == nil {
+        a.Profile.Identities = []database.ListIdentitiesForUserRow{}
+    }
+    if a.Chirps == nil {
+        a.Chirps = []database.Chirp{}
+    }
+    if a.Follows.Following == nil {
+        a.Follows.Following = []database.ListFollowingRow{}
+    }
+    if a.Follows.Followers == nil {
+        a.Follows.Followers = []database.ListFollowersRow{}
+    }
+    if a.Sessions.RefreshTokens == nil {
+        a.Sessions.RefreshTokens = []database.ListRefreshTokensForUserRow{}
+    }
+    if a.Sessions.APIKeys == nil {
+        a.Sessions.APIKeys = []database.ListAPIKeysForUserRow{}
+    }
+
+    files := []struct {
+        name string
+        v any
+    }{
+        { "profile.json", a.Profile },
+        { "chirps.json", a.Chirps },
+        { "follows.json", a.Follows },
+        { "sessions.json", a.Sessions },
+    }
+
+    buf := bytes.Buffer{}
+    zw := zip.NewWriter(&buf)
+    for _, f := range files {
+        d, err := json.MarshalIndent(f.v, "", "  ")
+        if err != nil {
+            return nil, err
+        }
+        w, err := zw.CreateHeader(&zip.FileHeader{ Name: f.name, Method: zip.Deflate, Modified: a.ExportedAt })
+        if err != nil {
+            return nil, err
+        }
+        _, err = w.Write(d)
+        if err != nil {
+            return nil, err
+        }
+    }
+    err := zw.Close()
+    if err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
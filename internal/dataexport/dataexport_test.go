@@ -0,0 +1,81 @@
+package dataexport_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/database"
+	"github.com/trice/Chirpy/internal/dataexport"
+)
+
+func TestZip(t *testing.T) {
+    userID := uuid.New()
+    tests := []struct {
+        name string
+        archive dataexport.Archive
+        chirps int
+    }{
+        {
+            name: "Empty account",
+            archive: dataexport.Archive{ Profile: dataexport.Profile{ ID: userID, Email: "a@example.com" } },
+        },
+        {
+            name: "With chirps",
+            archive: dataexport.Archive {
+                Profile: dataexport.Profile{ ID: userID, Email: "a@example.com" },
+                Chirps: []database.Chirp{ { ID: uuid.New(), Body: "hi", UserID: userID }, { ID: uuid.New(), Body: "there", UserID: userID } },
+            },
+            chirps: 2,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tt.archive.ExportedAt = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+            d, err := tt.archive.Zip()
+            if err != nil {
+                t.Fatalf("Zip() error = %v", err)
+            }
+
+            zr, err := zip.NewReader(bytes.NewReader(d), int64(len(d)))
+            if err != nil {
+                t.Fatalf("Zip() isn't a zip: %v", err)
+            }
+            files := map[string][]byte{}
+            for _, f := range zr.File {
+                rc, err := f.Open()
+                if err != nil {
+                    t.Fatalf("opening %s: %v", f.Name, err)
+                }
+                files[f.Name], _ = io.ReadAll(rc)
+                rc.Close()
+            }
+
+            for _, name := range []string{ "profile.json", "chirps.json", "follows.json", "sessions.json" } {
+                if !json.Valid(files[name]) {
+                    t.Errorf("%s is missing or not JSON: %q", name, files[name])
+                }
+            }
+            if bytes.Contains(files["profile.json"], []byte("hashed_password")) {
+                t.Errorf("profile.json leaks the password hash")
+            }
+
+            var chirps []database.Chirp
+            json.Unmarshal(files["chirps.json"], &chirps)
+            if chirps == nil || len(chirps) != tt.chirps {
+                t.Errorf("chirps.json has %v, want %d chirps", chirps, tt.chirps)
+            }
+
+            follows := map[string]json.RawMessage{}
+            json.Unmarshal(files["follows.json"], &follows)
+            if string(follows["following"]) != "[]" && len(tt.archive.Follows.Following) == 0 {
+                t.Errorf("follows.json following = %s, want []", follows["following"])
+            }
+        })
+    }
+}
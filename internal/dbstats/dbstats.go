@@ -0,0 +1,123 @@
+// Package dbstats wraps the connection sqlc queries run on, so every query
+// is timed, traced, counted when it fails and logged when it is slow,
+// without touching the generated code.
+package dbstats
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/trice/Chirpy/internal/database"
+	"github.com/trice/Chirpy/internal/logging"
+	"github.com/trice/Chirpy/internal/metrics"
+	"github.com/trice/Chirpy/internal/tracing"
+)
+
+// DB implements database.DBTX on top of another DBTX. Duration and Errors
+// are labelled with the query name, any of Duration, Errors and Tracer may
+// be nil. Queries taking longer than SlowQuery are logged, zero turns that
+// off.
+type DB struct {
+    DB database.DBTX
+    Duration *metrics.Histogram
+    Errors *metrics.Counter
+    Tracer *tracing.Tracer
+    SlowQuery time.Duration
+}
+
+// Wrap returns a copy of d running on db, typically a *sql.Tx, so queries
+// inside transactions are instrumented too:
+//
+//	qtx := database.New(d.Wrap(tx))
+func (d *DB) Wrap(db database.DBTX) *DB {
+    wrapped := *d
+    wrapped.DB = db
+    return &wrapped
+}
+
+// start opens the query's span, the returned func closes it and records
+// the rest
+func (d *DB) start(ctx context.Context, query string) (context.Context, func(error)) {
+    name := QueryName(query)
+    start := time.Now()
+
+    var span *tracing.Span
+    if d.Tracer != nil {
+        ctx, span = d.Tracer.Start(ctx, name, tracing.KindClient,
+            tracing.String("db.system", "postgresql"),
+            tracing.String("db.operation.name", name),
+        )
+    }
+
+    return ctx, func(err error) {
+        elapsed := time.Since(start)
+        // no rows is an answer, not a failure
+        if errors.Is(err, sql.ErrNoRows) {
+            err = nil
+        }
+
+        if span != nil {
+            span.SetError(err)
+            span.End()
+        }
+        if d.Duration != nil {
+            d.Duration.Observe(elapsed.Seconds(), name)
+        }
+        if err != nil && d.Errors != nil {
+            d.Errors.Inc(name)
+        }
+
+        logger := logging.FromContext(ctx)
+        switch {
+        case err != nil:
+            logger.Warn("query failed", "query", name, "latency", elapsed, "err", err)
+        case d.SlowQuery > 0 && elapsed >= d.SlowQuery:
+            logger.Warn("slow query", "query", name, "latency", elapsed, "threshold", d.SlowQuery)
+        default:
+            logger.Debug("query", "query", name, "latency", elapsed)
+        }
+    }
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+    ctx, done := d.start(ctx, query)
+    res, err := d.DB.ExecContext(ctx, query, args...)
+    done(err)
+    return res, err
+}
+
+// PrepareContext is passed straight through, the statement's queries are
+// what takes time and sqlc doesn't prepare unless asked to.
+func (d *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+    return d.DB.PrepareContext(ctx, query)
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+    ctx, done := d.start(ctx, query)
+    rows, err := d.DB.QueryContext(ctx, query, args...)
+    done(err)
+    return rows, err
+}
+
+// QueryRowContext only sees errors from running the query. Scan errors,
+// including no rows, happen after it returned.
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+    ctx, done := d.start(ctx, query)
+    row := d.DB.QueryRowContext(ctx, query, args...)
+    done(row.Err())
+    return row
+}
+
+// QueryName pulls the name out of the "-- name: GetChirps :many" comment
+// sqlc puts at the top of every query.
+func QueryName(query string) string {
+    rest, ok := strings.CutPrefix(query, "-- name: ")
+    if !ok {
+        return "unknown"
+    }
+    name, _, _ := strings.Cut(rest, " ")
+    return name
+}
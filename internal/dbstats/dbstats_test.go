@@ -0,0 +1,149 @@
+package dbstats_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trice/Chirpy/internal/dbstats"
+	"github.com/trice/Chirpy/internal/logging"
+	"github.com/trice/Chirpy/internal/metrics"
+)
+
+// fakeDB answers every query with err after sleeping for delay
+type fakeDB struct {
+    err   error
+    delay time.Duration
+}
+
+func (f fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+    time.Sleep(f.delay)
+    return nil, f.err
+}
+
+func (f fakeDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+    return nil, f.err
+}
+
+func (f fakeDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+    time.Sleep(f.delay)
+    return nil, f.err
+}
+
+func (f fakeDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+    return nil
+}
+
+func TestQueryName(t *testing.T) {
+    tests := []struct {
+        query string
+        want  string
+    }{
+        { "-- name: GetChirps :many\nSELECT * FROM chirps", "GetChirps" },
+        { "-- name: DeleteUser :exec\nDELETE FROM users", "DeleteUser" },
+        { "SELECT 1", "unknown" },
+    }
+
+    for _, tt := range tests {
+        got := dbstats.QueryName(tt.query)
+        if got != tt.want {
+            t.Errorf("QueryName(%q) = %q, want %q", tt.query, got, tt.want)
+        }
+    }
+}
+
+func TestDB(t *testing.T) {
+    tests := []struct {
+        name     string
+        db       fakeDB
+        slow     time.Duration
+        errors   float64
+        wantLog  string
+    }{
+        {
+            name:    "Fast",
+            db:      fakeDB{},
+            slow:    time.Hour,
+            errors:  0,
+            wantLog: "",
+        },
+        {
+            name:    "Slow",
+            db:      fakeDB{ delay: 5 * time.Millisecond },
+            slow:    time.Millisecond,
+            errors:  0,
+            wantLog: "slow query",
+        },
+        {
+            name:    "Failed",
+            db:      fakeDB{ err: errors.New("connection reset") },
+            slow:    time.Hour,
+            errors:  1,
+            wantLog: "query failed",
+        },
+        {
+            name:    "No rows",
+            db:      fakeDB{ err: sql.ErrNoRows },
+            slow:    time.Hour,
+            errors:  0,
+            wantLog: "",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            reg := metrics.NewRegistry()
+            db := &dbstats.DB {
+                DB:        tt.db,
+                Duration:  reg.NewHistogram("query_seconds", "help", metrics.DefBuckets, "query"),
+                Errors:    reg.NewCounter("query_errors_total", "help", "query"),
+                SlowQuery: tt.slow,
+            }
+
+            out := bytes.Buffer{}
+            logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{ Level: slog.LevelWarn }))
+            ctx := logging.WithLogger(context.Background(), logger)
+
+            db.ExecContext(ctx, "-- name: CreateChirp :one\nINSERT INTO chirps")
+
+            if got := db.Errors.Value("CreateChirp"); got != tt.errors {
+                t.Errorf("errors = %v, want %v", got, tt.errors)
+            }
+            if tt.wantLog == "" && out.Len() != 0 {
+                t.Errorf("unexpected log: %s", out.String())
+            }
+            if tt.wantLog != "" && !strings.Contains(out.String(), tt.wantLog) {
+                t.Errorf("log %q is missing %q", out.String(), tt.wantLog)
+            }
+
+            exposition := bytes.Buffer{}
+            reg.Write(&exposition)
+            if !strings.Contains(exposition.String(), `query_seconds_count{query="CreateChirp"} 1`) {
+                t.Errorf("duration not recorded:\n%s", exposition.String())
+            }
+        })
+    }
+}
+
+func TestWrap(t *testing.T) {
+    reg := metrics.NewRegistry()
+    db := &dbstats.DB {
+        DB:     fakeDB{},
+        Errors: reg.NewCounter("query_errors_total", "help", "query"),
+    }
+
+    tx := db.Wrap(fakeDB{ err: errors.New("deadlock") })
+    tx.QueryContext(context.Background(), "-- name: ListChirps :many\nSELECT")
+
+    if tx.Errors.Value("ListChirps") != 1 {
+        t.Errorf("errors inside the transaction were not counted")
+    }
+    if _, ok := db.DB.(fakeDB); !ok || db.DB.(fakeDB).err != nil {
+        t.Errorf("Wrap() changed the original")
+    }
+}
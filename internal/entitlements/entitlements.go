@@ -0,0 +1,53 @@
+package entitlements
+
+import "time"
+
+// Entitlements is everything a plan allows. Handlers ask for the user's
+// entitlements instead of checking is_chirpy_red themselves, so changing
+// what Red includes only ever touches this file.
+type Entitlements struct {
+    MaxChirpLength int
+    CanEditChirps bool
+    CanScheduleChirps bool
+    MaxScheduleAhead time.Duration
+    ChirpsPerHour int
+    // short bursts, enforced by the rate limiter in front of the chirp
+    // routes rather than by the handlers
+    ChirpsPerMinute int
+}
+
+var (
+    Free = Entitlements {
+        MaxChirpLength: 140,
+        CanEditChirps: false,
+        CanScheduleChirps: false,
+        ChirpsPerHour: 30,
+        ChirpsPerMinute: 20,
+    }
+
+    Red = Entitlements {
+        MaxChirpLength: 560,
+        CanEditChirps: true,
+        CanScheduleChirps: true,
+        MaxScheduleAhead: 30 * 24 * time.Hour,
+        ChirpsPerHour: 300,
+        ChirpsPerMinute: 100,
+    }
+)
+
+// Plans pairs the two plans so their limits can be configured, see
+// config.Config.ChirpMaxLength.
+type Plans struct {
+    Free Entitlements
+    Red Entitlements
+}
+
+var Default = Plans{ Free: Free, Red: Red }
+
+// For returns the entitlements of a user given their Chirpy Red status.
+func (p Plans) For(isChirpyRed bool) Entitlements {
+    if isChirpyRed {
+        return p.Red
+    }
+    return p.Free
+}
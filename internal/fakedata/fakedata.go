@@ -0,0 +1,266 @@
+// Package fakedata makes up users, follows and chirps for local development
+// and load tests. The same Options always give the same data, so a slow
+// query seen once can be looked at again.
+package fakedata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/database"
+)
+
+type Options struct {
+    Users int
+    Chirps int
+    // on average, each user follows between 1 and twice this many
+    FollowsPerUser int
+    // everything happens between Now - Span and Now
+    Span time.Duration
+    Now time.Time
+    Seed int64
+}
+
+// DefaultOptions is a small site that has been around for a while.
+func DefaultOptions() Options {
+    return Options {
+        Users: 100,
+        Chirps: 2000,
+        FollowsPerUser: 20,
+        Span: 180 * 24 * time.Hour,
+        Now: time.Now(),
+        Seed: 1,
+    }
+}
+
+type User struct {
+    Email string
+    IsChirpyRed bool
+    CreatedAt time.Time
+}
+
+// Follow and Chirp point at users by their index in Data.Users.
+type Follow struct {
+    Follower int
+    Followee int
+    CreatedAt time.Time
+}
+
+type Chirp struct {
+    Author int
+    Body string
+    CreatedAt time.Time
+}
+
+type Data struct {
+    Users []User
+    Follows []Follow
+    Chirps []Chirp
+}
+
+// Summary counts what Apply created.
+type Summary struct {
+    Users int `json:"users"`
+    Follows int `json:"follows"`
+    Chirps int `json:"chirps"`
+}
+
+var words = strings.Fields(`the a my our this that today tonight just finally
+    again still never always coffee code bug deploy release weekend meeting
+    lunch cat dog train rain sun morning night book movie song game team
+    project server database query test build is was feels looks went broke
+    shipped fixed found loved hated missed started finished and but so really
+    very pretty quite new old big small fast slow good bad great weird`)
+
+// Generate makes up the data without touching a database. Users sign up
+// over the whole span, a few of them write most of the chirps, popular users
+// get most of the followers, and everything happens after both sides exist.
+func Generate(opts Options) Data {
+    rng := rand.New(rand.NewSource(opts.Seed))
+    start := opts.Now.Add(-opts.Span)
+    data := Data{}
+    if opts.Users <= 0 {
+        return data
+    }
+
+    for i := 0; i < opts.Users; i++ {
+        data.Users = append(data.Users, User {
+            IsChirpyRed: rng.Intn(10) == 0,
+            CreatedAt: between(rng, start, opts.Now),
+        })
+    }
+    // early users get low numbers, like they would in a real table
+    sort.SliceStable(data.Users, func(i, j int) bool {
+        return data.Users[i].CreatedAt.Before(data.Users[j].CreatedAt)
+    })
+    for i := range data.Users {
+        data.Users[i].Email = fmt.Sprintf("user%04d@example.com", i + 1)
+    }
+
+    // popularity is a shuffled order, so the busiest account isn't always
+    // the oldest one
+    popular := rng.Perm(opts.Users)
+    var zipf *rand.Zipf
+    if opts.Users > 1 {
+        zipf = rand.NewZipf(rng, 1.2, 1, uint64(opts.Users - 1))
+    }
+    pick := func() int {
+        if zipf == nil {
+            return popular[0]
+        }
+        return popular[zipf.Uint64()]
+    }
+
+    for follower := range data.Users {
+        n := opts.FollowsPerUser
+        if n > 0 {
+            n = rng.Intn(2 * n) + 1
+        }
+        if n > opts.Users - 1 {
+            n = opts.Users - 1
+        }
+        seen := map[int]bool{ follower: true }
+        // the attempt cap keeps tiny user counts from spinning forever
+        for tries := 0; len(seen) - 1 < n && tries < 10 * n; tries++ {
+            followee := pick()
+            if seen[followee] {
+                continue
+            }
+            seen[followee] = true
+            data.Follows = append(data.Follows, Follow {
+                Follower: follower,
+                Followee: followee,
+                CreatedAt: between(rng, later(data.Users[follower].CreatedAt, data.Users[followee].CreatedAt), opts.Now),
+            })
+        }
+    }
+
+    for i := 0; i < opts.Chirps; i++ {
+        author := pick()
+        data.Chirps = append(data.Chirps, Chirp {
+            Author: author,
+            Body: sentence(rng),
+            CreatedAt: daytime(rng, data.Users[author].CreatedAt, opts.Now),
+        })
+    }
+    sort.SliceStable(data.Chirps, func(i, j int) bool {
+        return data.Chirps[i].CreatedAt.Before(data.Chirps[j].CreatedAt)
+    })
+    return data
+}
+
+// Apply creates data through q. Pass queries bound to a transaction to get
+// all or nothing. Every user gets password, there is no default so nobody
+// ends up with accounts anyone can guess. It is hashed once for everyone,
+// bcrypt per user would make big runs crawl.
+func Apply(ctx context.Context, q *database.Queries, data Data, password string) (Summary, error) {
+    summary := Summary{}
+    if len(password) == 0 {
+        return summary, errors.New("a password for the generated users is required")
+    }
+    hash, err := auth.HashPassword(password)
+    if err != nil {
+        return summary, err
+    }
+
+    users := make([]database.CreateUserAtRow, len(data.Users))
+    for i, u := range data.Users {
+        param := database.CreateUserAtParams {
+            CreatedAt: u.CreatedAt,
+            Email: u.Email,
+            HashedPassword: hash,
+        }
+        users[i], err = q.CreateUserAt(ctx, param)
+        if err != nil {
+            return summary, fmt.Errorf("creating %s: %w", u.Email, err)
+        }
+        if u.IsChirpyRed {
+            _, err = q.UpdateRed(ctx, database.UpdateRedParams{ ID: users[i].ID, IsChirpyRed: true })
+            if err != nil {
+                return summary, fmt.Errorf("updating %s: %w", u.Email, err)
+            }
+        }
+        summary.Users++
+    }
+
+    for _, f := range data.Follows {
+        param := database.CreateFollowParams {
+            FollowerID: users[f.Follower].ID,
+            FolloweeID: users[f.Followee].ID,
+            CreatedAt: f.CreatedAt,
+        }
+        n, err := q.CreateFollow(ctx, param)
+        if err != nil {
+            return summary, fmt.Errorf("creating follow: %w", err)
+        }
+        summary.Follows += int(n)
+    }
+
+    for _, c := range data.Chirps {
+        param := database.CreateChirpAtParams {
+            CreatedAt: c.CreatedAt,
+            Body: c.Body,
+            UserID: users[c.Author].ID,
+        }
+        _, err = q.CreateChirpAt(ctx, param)
+        if err != nil {
+            return summary, fmt.Errorf("creating chirp: %w", err)
+        }
+        summary.Chirps++
+    }
+    return summary, nil
+}
+
+func between(rng *rand.Rand, from, to time.Time) time.Time {
+    d := to.Sub(from)
+    if d <= 0 {
+        return from
+    }
+    return from.Add(time.Duration(rng.Int63n(int64(d))))
+}
+
+func later(a, b time.Time) time.Time {
+    if a.After(b) {
+        return a
+    }
+    return b
+}
+
+// daytime picks a time between from and to, mostly between 08:00 and 23:00
+// UTC since people chirp while they're awake.
+func daytime(rng *rand.Rand, from, to time.Time) time.Time {
+    t := between(rng, from, to)
+    if rng.Intn(10) == 0 {
+        return t
+    }
+    moved := t.Truncate(24 * time.Hour).Add(8 * time.Hour + time.Duration(rng.Int63n(int64(15 * time.Hour))))
+    if moved.Before(from) || moved.After(to) {
+        return t
+    }
+    return moved
+}
+
+func sentence(rng *rand.Rand) string {
+    // short enough to fit the free plan's 140 characters
+    n := 3 + rng.Intn(12)
+    parts := make([]string, n)
+    for i := range parts {
+        parts[i] = words[rng.Intn(len(words))]
+    }
+    s := strings.Join(parts, " ")
+    s = strings.ToUpper(s[:1]) + s[1:]
+    switch rng.Intn(4) {
+    case 0:
+        return s + "!"
+    case 1:
+        return s + "?"
+    default:
+        return s + "."
+    }
+}
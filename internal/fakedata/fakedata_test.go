@@ -0,0 +1,106 @@
+package fakedata_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/trice/Chirpy/internal/fakedata"
+)
+
+func TestGenerate(t *testing.T) {
+    now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+    tests := []struct {
+        name string
+        opts fakedata.Options
+    }{
+        {
+            name: "Defaults",
+            opts: fakedata.Options{ Users: 100, Chirps: 2000, FollowsPerUser: 20, Span: 180 * 24 * time.Hour, Now: now, Seed: 1 },
+        },
+        {
+            name: "More follows than users",
+            opts: fakedata.Options{ Users: 3, Chirps: 10, FollowsPerUser: 50, Span: time.Hour, Now: now, Seed: 7 },
+        },
+        {
+            name: "Single user",
+            opts: fakedata.Options{ Users: 1, Chirps: 5, FollowsPerUser: 5, Span: 24 * time.Hour, Now: now, Seed: 3 },
+        },
+        {
+            name: "No users",
+            opts: fakedata.Options{ Chirps: 5, Now: now },
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            data := fakedata.Generate(tt.opts)
+            if !reflect.DeepEqual(data, fakedata.Generate(tt.opts)) {
+                t.Fatalf("Generate() isn't deterministic")
+            }
+            if len(data.Users) != tt.opts.Users {
+                t.Errorf("Generate() got %d users, want %d", len(data.Users), tt.opts.Users)
+            }
+            if tt.opts.Users > 0 && len(data.Chirps) != tt.opts.Chirps {
+                t.Errorf("Generate() got %d chirps, want %d", len(data.Chirps), tt.opts.Chirps)
+            }
+
+            start := now.Add(-tt.opts.Span)
+            emails := map[string]bool{}
+            for _, u := range data.Users {
+                if emails[u.Email] {
+                    t.Errorf("duplicate email %s", u.Email)
+                }
+                emails[u.Email] = true
+                if u.CreatedAt.Before(start) || u.CreatedAt.After(now) {
+                    t.Errorf("user %s created at %v, outside of the span", u.Email, u.CreatedAt)
+                }
+            }
+
+            follows := map[[2]int]bool{}
+            for _, f := range data.Follows {
+                if f.Follower == f.Followee {
+                    t.Errorf("user %d follows themselves", f.Follower)
+                }
+                if follows[[2]int{ f.Follower, f.Followee }] {
+                    t.Errorf("user %d follows %d twice", f.Follower, f.Followee)
+                }
+                follows[[2]int{ f.Follower, f.Followee }] = true
+                if f.CreatedAt.Before(data.Users[f.Follower].CreatedAt) || f.CreatedAt.Before(data.Users[f.Followee].CreatedAt) || f.CreatedAt.After(now) {
+                    t.Errorf("follow %d -> %d at %v, before a user existed", f.Follower, f.Followee, f.CreatedAt)
+                }
+            }
+
+            for i, c := range data.Chirps {
+                if len(c.Body) == 0 || len(c.Body) > 140 {
+                    t.Errorf("chirp %d is %d long", i, len(c.Body))
+                }
+                if c.CreatedAt.Before(data.Users[c.Author].CreatedAt) || c.CreatedAt.After(now) {
+                    t.Errorf("chirp %d at %v, before its author existed", i, c.CreatedAt)
+                }
+                if i > 0 && c.CreatedAt.Before(data.Chirps[i - 1].CreatedAt) {
+                    t.Errorf("chirp %d is out of order", i)
+                }
+            }
+        })
+    }
+}
+
+func TestGenerateSeed(t *testing.T) {
+    opts := fakedata.DefaultOptions()
+    a := fakedata.Generate(opts)
+    opts.Seed++
+    b := fakedata.Generate(opts)
+    if reflect.DeepEqual(a, b) {
+        t.Errorf("Generate() gave the same data for different seeds")
+    }
+}
+
+func TestApplyNeedsAPassword(t *testing.T) {
+    data := fakedata.Generate(fakedata.Options{ Users: 1, Now: time.Now(), Seed: 1 })
+    // refused before anything touches the database
+    _, err := fakedata.Apply(t.Context(), nil, data, "")
+    if err == nil {
+        t.Errorf("Apply() without a password = nil error")
+    }
+}
@@ -0,0 +1,89 @@
+// Package fixtures loads hand written test data, like the accounts a
+// developer always wants to have around, from a JSON file:
+//
+//	{"users": [{"email": "admin@example.com", "password": "hunter2",
+//	  "is_admin": true, "chirps": ["Hello, Chirpy!"]}]}
+package fixtures
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/database"
+)
+
+type User struct {
+    Email string `json:"email"`
+    Password string `json:"password"`
+    IsChirpyRed bool `json:"is_chirpy_red"`
+    IsAdmin bool `json:"is_admin"`
+    Chirps []string `json:"chirps"`
+}
+
+type Fixtures struct {
+    Users []User `json:"users"`
+}
+
+// Summary counts what Apply created.
+type Summary struct {
+    Users int `json:"users"`
+    Chirps int `json:"chirps"`
+}
+
+func Load(path string) (Fixtures, error) {
+    d, err := os.ReadFile(path)
+    if err != nil {
+        return Fixtures{}, err
+    }
+
+    f := Fixtures{}
+    err = json.Unmarshal(d, &f)
+    if err != nil {
+        return Fixtures{}, fmt.Errorf("%s: %w", path, err)
+    }
+    for i, u := range f.Users {
+        if len(u.Email) == 0 || len(u.Password) == 0 {
+            return Fixtures{}, fmt.Errorf("%s: user %d needs an email and a password", path, i)
+        }
+    }
+    return f, nil
+}
+
+// Apply creates the fixtures through q. Pass queries bound to a
+// transaction to get all or nothing.
+func Apply(ctx context.Context, q *database.Queries, f Fixtures) (Summary, error) {
+    summary := Summary{}
+    for _, u := range f.Users {
+        hash, err := auth.HashPassword(u.Password)
+        if err != nil {
+            return summary, err
+        }
+        user, err := q.CreateUser(ctx, database.CreateUserParams{ Email: u.Email, HashedPassword: hash })
+        if err != nil {
+            return summary, fmt.Errorf("creating %s: %w", u.Email, err)
+        }
+        summary.Users++
+
+        if u.IsAdmin {
+            _, err = q.SetUserAdmin(ctx, database.SetUserAdminParams{ ID: user.ID, IsAdmin: true })
+        }
+        if err == nil && u.IsChirpyRed {
+            _, err = q.UpdateRed(ctx, database.UpdateRedParams{ ID: user.ID, IsChirpyRed: true })
+        }
+        if err != nil {
+            return summary, fmt.Errorf("updating %s: %w", u.Email, err)
+        }
+
+        for _, body := range u.Chirps {
+            _, err = q.CreateChirp(ctx, database.CreateChirpParams{ Body: body, UserID: user.ID })
+            if err != nil {
+                return summary, fmt.Errorf("creating chirp for %s: %w", u.Email, err)
+            }
+            summary.Chirps++
+        }
+    }
+    return summary, nil
+}
@@ -0,0 +1,56 @@
+package fixtures_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/trice/Chirpy/internal/fixtures"
+)
+
+func TestLoad(t *testing.T) {
+    tests := []struct {
+        name    string
+        text    string
+        users   int
+        wantErr bool
+    }{
+        {
+            name:  "Users with chirps",
+            text:  `{"users": [{"email": "a@example.com", "password": "pw", "is_admin": true, "chirps": ["hi", "there"]}, {"email": "b@example.com", "password": "pw"}]}`,
+            users: 2,
+        },
+        {
+            name:    "Missing password",
+            text:    `{"users": [{"email": "a@example.com"}]}`,
+            wantErr: true,
+        },
+        {
+            name:    "Not JSON",
+            text:    `users: []`,
+            wantErr: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            path := filepath.Join(t.TempDir(), "fixtures.json")
+            os.WriteFile(path, []byte(tt.text), 0o600)
+
+            f, err := fixtures.Load(path)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+            }
+            if len(f.Users) != tt.users {
+                t.Errorf("Load() got %d users, want %d", len(f.Users), tt.users)
+            }
+        })
+    }
+}
+
+func TestLoadDevFixtures(t *testing.T) {
+    _, err := fixtures.Load("../../fixtures/dev.json")
+    if err != nil {
+        t.Errorf("the checked in fixtures don't load: %v", err)
+    }
+}
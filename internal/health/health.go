@@ -0,0 +1,126 @@
+// Package health answers readiness probes by running a set of dependency
+// checks, and reports not ready once the server starts shutting down so
+// load balancers stop sending it traffic before connections are closed.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check returns nil when the dependency is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+    name string
+    check Check
+}
+
+// Checker runs every check, in parallel, on each readiness probe. Each
+// check gets Timeout, or 2 seconds when it is zero.
+type Checker struct {
+    Timeout time.Duration
+
+    checks []namedCheck
+    shuttingDown atomic.Bool
+}
+
+// Add registers check under name. It isn't safe to call once the handler
+// is serving.
+func (c *Checker) Add(name string, check Check) {
+    c.checks = append(c.checks, namedCheck{ name, check })
+}
+
+// ShutDown makes every following probe fail.
+func (c *Checker) ShutDown() {
+    c.shuttingDown.Store(true)
+}
+
+const (
+    StatusOK = "ok"
+    StatusFailing = "failing"
+    StatusShuttingDown = "shutting_down"
+)
+
+// CheckResult is what a check did. Only the status goes out to whoever
+// probes, the rest is for the log.
+type CheckResult struct {
+    Status string `json:"status"`
+    Latency time.Duration `json:"-"`
+    Error string `json:"-"`
+}
+
+type Report struct {
+    Status string `json:"status"`
+    Checks map[string]CheckResult `json:"checks"`
+}
+
+// Run runs the checks and sums them up.
+func (c *Checker) Run(ctx context.Context) Report {
+    report := Report{ Status: StatusOK, Checks: map[string]CheckResult{} }
+    if c.shuttingDown.Load() {
+        report.Status = StatusShuttingDown
+        return report
+    }
+
+    timeout := c.Timeout
+    if timeout == 0 {
+        timeout = 2 * time.Second
+    }
+
+    mu := sync.Mutex{}
+    wg := sync.WaitGroup{}
+    for _, nc := range c.checks {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            ctx, cancel := context.WithTimeout(ctx, timeout)
+            defer cancel()
+
+            start := time.Now()
+            err := nc.check(ctx)
+            result := CheckResult{ Status: StatusOK, Latency: time.Since(start) }
+            if err != nil {
+                result.Status = StatusFailing
+                result.Error = err.Error()
+            }
+
+            mu.Lock()
+            defer mu.Unlock()
+            report.Checks[nc.name] = result
+            if err != nil {
+                report.Status = StatusFailing
+            }
+        }()
+    }
+    wg.Wait()
+    return report
+}
+
+// Handler serves the report as JSON, with 503 unless everything is ok. The
+// endpoint is public, so why a check failed is only logged.
+func (c *Checker) Handler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        report := c.Run(r.Context())
+        code := http.StatusOK
+        if report.Status != StatusOK {
+            code = http.StatusServiceUnavailable
+        }
+        for name, result := range report.Checks {
+            if result.Status != StatusOK {
+                slog.Warn("readiness check failing", "check", name, "latency", result.Latency, "err", result.Error)
+            }
+        }
+
+        d, _ := json.Marshal(report)
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.Header().Set("Cache-Control", "no-store")
+        w.WriteHeader(code)
+        w.Write(d)
+    })
+}
@@ -0,0 +1,102 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trice/Chirpy/internal/health"
+)
+
+func ok(ctx context.Context) error {
+    return nil
+}
+
+func down(ctx context.Context) error {
+    return errors.New("connection refused")
+}
+
+func hang(ctx context.Context) error {
+    <-ctx.Done()
+    return ctx.Err()
+}
+
+func TestHandler(t *testing.T) {
+    tests := []struct {
+        name       string
+        checks     map[string]health.Check
+        shutdown   bool
+        wantCode   int
+        wantStatus string
+        failing    []string
+    }{
+        {
+            name:       "All good",
+            checks:     map[string]health.Check{ "database": ok, "migrations": ok },
+            wantCode:   http.StatusOK,
+            wantStatus: health.StatusOK,
+        },
+        {
+            name:       "Database down",
+            checks:     map[string]health.Check{ "database": down, "migrations": ok },
+            wantCode:   http.StatusServiceUnavailable,
+            wantStatus: health.StatusFailing,
+            failing:    []string{ "database" },
+        },
+        {
+            name:       "Check times out",
+            checks:     map[string]health.Check{ "database": hang },
+            wantCode:   http.StatusServiceUnavailable,
+            wantStatus: health.StatusFailing,
+            failing:    []string{ "database" },
+        },
+        {
+            name:       "Shutting down",
+            checks:     map[string]health.Check{ "database": ok },
+            shutdown:   true,
+            wantCode:   http.StatusServiceUnavailable,
+            wantStatus: health.StatusShuttingDown,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            checker := &health.Checker{ Timeout: 10 * time.Millisecond }
+            for name, check := range tt.checks {
+                checker.Add(name, check)
+            }
+            if tt.shutdown {
+                checker.ShutDown()
+            }
+
+            rec := httptest.NewRecorder()
+            checker.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/api/readyz", nil))
+
+            if rec.Code != tt.wantCode {
+                t.Errorf("code = %d, want %d", rec.Code, tt.wantCode)
+            }
+            report := health.Report{}
+            err := json.Unmarshal(rec.Body.Bytes(), &report)
+            if err != nil {
+                t.Fatalf("body is not JSON: %v", err)
+            }
+            if report.Status != tt.wantStatus {
+                t.Errorf("status = %q, want %q", report.Status, tt.wantStatus)
+            }
+            for _, name := range tt.failing {
+                if report.Checks[name].Status != health.StatusFailing {
+                    t.Errorf("check %s = %+v, want failing", name, report.Checks[name])
+                }
+            }
+            // the probe is public, errors only go to the log
+            if strings.Contains(rec.Body.String(), "connection refused") || strings.Contains(rec.Body.String(), "deadline") {
+                t.Errorf("body leaks the check error: %s", rec.Body)
+            }
+        })
+    }
+}
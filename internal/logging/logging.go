@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// RequestIDHeader is read from incoming requests, so an ID assigned by a
+// proxy in front of Chirpy carries through, and echoed on every response.
+const RequestIDHeader = "X-Request-ID"
+
+type loggerKey struct{}
+type requestInfoKey struct{}
+
+// RequestInfo collects what handlers learn about a request that the access
+// log line wants to show, like who turned out to be making it.
+type RequestInfo struct {
+    mu sync.Mutex
+    userID string
+}
+
+// New builds the process logger. format is "json" or "text", level one of
+// debug, info, warn or error.
+func New(out io.Writer, format, level string) *slog.Logger {
+    var lvl slog.Level
+    err := lvl.UnmarshalText([]byte(level))
+    if err != nil {
+        lvl = slog.LevelInfo
+    }
+
+    opts := &slog.HandlerOptions{ Level: lvl }
+    if strings.EqualFold(format, "text") {
+        return slog.New(slog.NewTextHandler(out, opts))
+    }
+    return slog.New(slog.NewJSONHandler(out, opts))
+}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+    return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the request scoped logger, or the default logger
+// outside of a request.
+func FromContext(ctx context.Context) *slog.Logger {
+    logger, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+    if !ok {
+        return slog.Default()
+    }
+    return logger
+}
+
+func WithRequestInfo(ctx context.Context) (context.Context, *RequestInfo) {
+    info := &RequestInfo{}
+    return context.WithValue(ctx, requestInfoKey{}, info), info
+}
+
+// SetUserID records the authenticated user for the access log. It does
+// nothing outside of a request.
+func SetUserID(ctx context.Context, userID string) {
+    info, ok := ctx.Value(requestInfoKey{}).(*RequestInfo)
+    if !ok {
+        return
+    }
+    info.mu.Lock()
+    defer info.mu.Unlock()
+    info.userID = userID
+}
+
+func (i *RequestInfo) UserID() string {
+    i.mu.Lock()
+    defer i.mu.Unlock()
+    return i.userID
+}
+
+// RequestID returns id when it is something sensible to put in logs,
+// otherwise a new random one.
+func RequestID(id string) string {
+    if len(id) != 0 && len(id) <= 128 && isPrintable(id) {
+        return id
+    }
+    buf := make([]byte, 16)
+    rand.Read(buf)
+    return hex.EncodeToString(buf)
+}
+
+func isPrintable(s string) bool {
+    for i := 0; i < len(s); i++ {
+        if s[i] < 0x21 || s[i] > 0x7e {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,73 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/trice/Chirpy/internal/logging"
+)
+
+func TestRequestID(t *testing.T) {
+    tests := []struct {
+        name     string
+        id       string
+        keep     bool
+    }{
+        {
+            name: "From proxy",
+            id:   "3f1c9a2e-7b4d-4e8a-9c1f-2a6b8d0e4f57",
+            keep: true,
+        },
+        {
+            name: "Missing",
+            id:   "",
+            keep: false,
+        },
+        {
+            name: "Log injection",
+            id:   "abc\n{\"level\":\"ERROR\"}",
+            keep: false,
+        },
+        {
+            name: "Too long",
+            id:   strings.Repeat("a", 129),
+            keep: false,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := logging.RequestID(tt.id)
+            if (got == tt.id) != tt.keep {
+                t.Errorf("RequestID(%q) = %q, keep %v", tt.id, got, tt.keep)
+            }
+            if len(got) == 0 {
+                t.Errorf("RequestID(%q) is empty", tt.id)
+            }
+        })
+    }
+}
+
+func TestContextLogger(t *testing.T) {
+    out := bytes.Buffer{}
+    logger := logging.New(&out, "json", "info").With("request_id", "req-1")
+
+    ctx, info := logging.WithRequestInfo(logging.WithLogger(context.Background(), logger))
+    logging.FromContext(ctx).Info("hello")
+    logging.SetUserID(ctx, "user-1")
+
+    if !strings.Contains(out.String(), `"request_id":"req-1"`) {
+        t.Errorf("log line is missing the request id: %s", out.String())
+    }
+    if info.UserID() != "user-1" {
+        t.Errorf("UserID() = %q", info.UserID())
+    }
+
+    // outside a request these must not blow up
+    logging.SetUserID(context.Background(), "user-2")
+    if logging.FromContext(context.Background()) == nil {
+        t.Errorf("FromContext() returned nil")
+    }
+}
@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// Sender delivers a plain text message to a single recipient.
+type Sender interface {
+    Send(ctx context.Context, to, subject, body string) error
+}
+
+// LogSender writes messages to Out instead of delivering them, handy for
+// local development where there is no mail server around.
+type LogSender struct {
+    Out io.Writer
+}
+
+func (s LogSender) Send(ctx context.Context, to, subject, body string) error {
+    _, err := fmt.Fprintf(s.Out, "mail to=%s subject=%q\n%s\n", to, subject, body)
+    return err
+}
+
+// SMTPSender delivers messages through an SMTP relay. Username and Password
+// are optional, when empty no AUTH is attempted.
+type SMTPSender struct {
+    Addr string
+    From string
+    Username string
+    Password string
+}
+
+func (s SMTPSender) Send(ctx context.Context, to, subject, body string) error {
+    // every value that ends up in a header, a line break would let it add
+    // headers of its own
+    for _, v := range []string{ s.From, to, subject } {
+        if strings.ContainsAny(v, "\r\n") {
+            return fmt.Errorf("Invalid mail header")
+        }
+    }
+
+    var a smtp.Auth
+    if len(s.Username) != 0 {
+        host, _, err := net.SplitHostPort(s.Addr)
+        if err != nil {
+            return err
+        }
+        a = smtp.PlainAuth("", s.Username, s.Password, host)
+    }
+
+    msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", s.From, to, subject, body)
+    return smtp.SendMail(s.Addr, a, s.From, []string{to}, []byte(msg))
+}
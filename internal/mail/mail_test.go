@@ -0,0 +1,32 @@
+package mail_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/trice/Chirpy/internal/mail"
+)
+
+func TestSMTPSenderHeaderInjection(t *testing.T) {
+    tests := []struct {
+        name    string
+        from    string
+        to      string
+        subject string
+    }{
+        { name: "Line break in to", from: "chirpy@example.com", to: "a@example.com\r\nBcc: b@example.com", subject: "hi" },
+        { name: "Line break in subject", from: "chirpy@example.com", to: "a@example.com", subject: "hi\nBcc: b@example.com" },
+        { name: "Line break in from", from: "chirpy@example.com\r\nBcc: b@example.com", to: "a@example.com", subject: "hi" },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            // nothing listens there, the header check has to fail first
+            s := mail.SMTPSender{ Addr: "127.0.0.1:1", From: tt.from }
+            err := s.Send(context.Background(), tt.to, tt.subject, "body")
+            if err == nil || err.Error() != "Invalid mail header" {
+                t.Errorf("Send() error = %v, want Invalid mail header", err)
+            }
+        })
+    }
+}
@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets suit request latencies, from 5ms to 10s.
+var DefBuckets = []float64{ .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10 }
+
+// Registry holds metrics and writes them in the Prometheus text exposition
+// format. It only does the handful of things Chirpy needs, which beats
+// pulling in the whole client library.
+type Registry struct {
+    mu sync.Mutex
+    metrics []metric
+}
+
+type metric interface {
+    write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+    return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.metrics = append(r.metrics, m)
+}
+
+func (r *Registry) Write(w io.Writer) error {
+    r.mu.Lock()
+    metrics := append([]metric(nil), r.metrics...)
+    r.mu.Unlock()
+
+    bw := bufio.NewWriter(w)
+    for _, m := range metrics {
+        m.write(bw)
+    }
+    return bw.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+        w.WriteHeader(http.StatusOK)
+        r.Write(w)
+    })
+}
+
+// series is one label combination of a metric
+type series struct {
+    labels []string
+    value float64
+    counts []uint64
+    sum float64
+}
+
+type vec struct {
+    name string
+    help string
+    labels []string
+    mu sync.Mutex
+    series map[string]*series
+}
+
+func newVec(name, help string, labels []string) vec {
+    return vec{ name: name, help: help, labels: labels, series: map[string]*series{} }
+}
+
+func (v *vec) get(values []string) *series {
+    if len(values) != len(v.labels) {
+        panic(fmt.Sprintf("metric %s wants %d labels, got %d", v.name, len(v.labels), len(values)))
+    }
+    key := strings.Join(values, "\xff")
+    s, ok := v.series[key]
+    if !ok {
+        s = &series{ labels: append([]string(nil), values...) }
+        v.series[key] = s
+    }
+    return s
+}
+
+func (v *vec) sorted() []*series {
+    out := make([]*series, 0, len(v.series))
+    for _, s := range v.series {
+        out = append(out, s)
+    }
+    sort.Slice(out, func(i, j int) bool {
+        return strings.Join(out[i].labels, "\xff") < strings.Join(out[j].labels, "\xff")
+    })
+    return out
+}
+
+func (v *vec) header(w *bufio.Writer, kind string) {
+    fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+    fmt.Fprintf(w, "# TYPE %s %s\n", v.name, kind)
+}
+
+// Counter only goes up, per label combination.
+type Counter struct {
+    vec
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+    c := &Counter{ newVec(name, help, labels) }
+    r.register(c)
+    return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+    c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.get(labelValues).value += v
+}
+
+func (c *Counter) Value(labelValues ...string) float64 {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.get(labelValues).value
+}
+
+// Reset zeroes every series. Scrapers treat it like a process restart.
+func (c *Counter) Reset() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.series = map[string]*series{}
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.header(w, "counter")
+    for _, s := range c.sorted() {
+        fmt.Fprintf(w, "%s%s %s\n", c.name, labelString(c.labels, s.labels, "", ""), formatFloat(s.value))
+    }
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+    vec
+    buckets []float64
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+    h := &Histogram{ newVec(name, help, labels), buckets }
+    r.register(h)
+    return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    s := h.get(labelValues)
+    if s.counts == nil {
+        s.counts = make([]uint64, len(h.buckets) + 1)
+    }
+    i := sort.SearchFloat64s(h.buckets, v)
+    s.counts[i]++
+    s.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    h.header(w, "histogram")
+    for _, s := range h.sorted() {
+        var cumulative uint64
+        for i, upper := range h.buckets {
+            cumulative += s.counts[i]
+            fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, s.labels, "le", formatFloat(upper)), cumulative)
+        }
+        cumulative += s.counts[len(h.buckets)]
+        fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, s.labels, "le", "+Inf"), cumulative)
+        fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels, s.labels, "", ""), formatFloat(s.sum))
+        fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels, s.labels, "", ""), cumulative)
+    }
+}
+
+// GaugeFunc is read when scraped, for values that live elsewhere.
+type GaugeFunc struct {
+    name string
+    help string
+    fn func() (float64, error)
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() (float64, error)) {
+    r.register(&GaugeFunc{ name, help, fn })
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+    v, err := g.fn()
+    if err != nil {
+        // better no sample than a wrong one
+        return
+    }
+    fmt.Fprintf(w, "# HELP %s %s\n", g.name, escapeHelp(g.help))
+    fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+    fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(v))
+}
+
+func labelString(names, values []string, extraName, extraValue string) string {
+    if len(names) == 0 && len(extraName) == 0 {
+        return ""
+    }
+    parts := make([]string, 0, len(names) + 1)
+    for i, name := range names {
+        parts = append(parts, name + `="` + escapeLabel(values[i]) + `"`)
+    }
+    if len(extraName) != 0 {
+        parts = append(parts, extraName + `="` + extraValue + `"`)
+    }
+    return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+    switch {
+    case math.IsInf(v, 1):
+        return "+Inf"
+    case math.IsInf(v, -1):
+        return "-Inf"
+    }
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+    return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+    return helpEscaper.Replace(s)
+}
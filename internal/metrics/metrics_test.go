@@ -0,0 +1,58 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/trice/Chirpy/internal/metrics"
+)
+
+func TestExposition(t *testing.T) {
+    reg := metrics.NewRegistry()
+
+    requests := reg.NewCounter("http_requests_total", "Requests served.", "route", "status")
+    requests.Inc("GET /api/chirps", "200")
+    requests.Inc("GET /api/chirps", "200")
+    requests.Inc(`say "hi"`, "404")
+
+    latency := reg.NewHistogram("http_request_duration_seconds", "Request latency.", []float64{ 0.1, 1 }, "route")
+    latency.Observe(0.05, "GET /api/chirps")
+    latency.Observe(0.5, "GET /api/chirps")
+    latency.Observe(3, "GET /api/chirps")
+
+    reg.NewGaugeFunc("active_sessions", "Sessions.", func() (float64, error) {
+        return 7, nil
+    })
+
+    out := strings.Builder{}
+    reg.Write(&out)
+
+    expected := `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{route="GET /api/chirps",status="200"} 2
+http_requests_total{route="say \"hi\"",status="404"} 1
+# HELP http_request_duration_seconds Request latency.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{route="GET /api/chirps",le="0.1"} 1
+http_request_duration_seconds_bucket{route="GET /api/chirps",le="1"} 2
+http_request_duration_seconds_bucket{route="GET /api/chirps",le="+Inf"} 3
+http_request_duration_seconds_sum{route="GET /api/chirps"} 3.55
+http_request_duration_seconds_count{route="GET /api/chirps"} 3
+# HELP active_sessions Sessions.
+# TYPE active_sessions gauge
+active_sessions 7
+`
+    if out.String() != expected {
+        t.Errorf("Write() =\n%s\nwant\n%s", out.String(), expected)
+    }
+}
+
+func TestCounterReset(t *testing.T) {
+    reg := metrics.NewRegistry()
+    hits := reg.NewCounter("hits_total", "Hits.")
+    hits.Inc()
+    hits.Reset()
+    if hits.Value() != 0 {
+        t.Errorf("Value() after Reset() = %v", hits.Value())
+    }
+}
@@ -0,0 +1,202 @@
+// Package migrate applies goose style SQL migrations. It keeps its
+// bookkeeping in goose's goose_db_version table, so databases migrated with
+// the goose CLI and with Chirpy itself can be mixed freely.
+package migrate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is one NNN_name.sql file.
+type Migration struct {
+    Version int64
+    Name string
+    Up []string
+    Down []string
+    // NoTx is set by "-- +goose NO TRANSACTION", for statements like
+    // CREATE INDEX CONCURRENTLY that refuse to run in a transaction
+    NoTx bool
+}
+
+// Load reads every .sql file at the root of fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+    names, err := fs.Glob(fsys, "*.sql")
+    if err != nil {
+        return nil, err
+    }
+
+    migrations := []Migration{}
+    seen := map[int64]string{}
+    for _, name := range names {
+        prefix, _, ok := strings.Cut(name, "_")
+        version, err := strconv.ParseInt(prefix, 10, 64)
+        if !ok || err != nil || version <= 0 {
+            return nil, fmt.Errorf("%s: file name must start with a version like 001_", name)
+        }
+        if other, dup := seen[version]; dup {
+            return nil, fmt.Errorf("%s and %s have the same version", other, name)
+        }
+        seen[version] = name
+
+        d, err := fs.ReadFile(fsys, name)
+        if err != nil {
+            return nil, err
+        }
+        m, err := Parse(string(d))
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", name, err)
+        }
+        m.Version = version
+        m.Name = strings.TrimSuffix(path.Base(name), ".sql")
+        migrations = append(migrations, m)
+    }
+
+    sort.Slice(migrations, func(i, j int) bool {
+        return migrations[i].Version < migrations[j].Version
+    })
+    return migrations, nil
+}
+
+// Parse splits a migration into its up and down statements the way goose
+// does: a statement ends with a line ending in a semicolon, unless it is
+// wrapped in StatementBegin and StatementEnd.
+func Parse(text string) (Migration, error) {
+    m := Migration{}
+    var section *[]string
+    inBlock := false
+    stmt := strings.Builder{}
+
+    flush := func() {
+        s := strings.TrimSpace(stmt.String())
+        if len(s) != 0 && section != nil {
+            *section = append(*section, s)
+        }
+        stmt.Reset()
+    }
+
+    scanner := bufio.NewScanner(strings.NewReader(text))
+    scanner.Buffer(nil, 1 << 20)
+    for scanner.Scan() {
+        line := scanner.Text()
+        trimmed := strings.TrimSpace(line)
+
+        if annotation, ok := strings.CutPrefix(trimmed, "-- +goose "); ok {
+            switch strings.TrimSpace(annotation) {
+            case "Up":
+                flush()
+                section = &m.Up
+            case "Down":
+                flush()
+                section = &m.Down
+            case "StatementBegin":
+                flush()
+                inBlock = true
+            case "StatementEnd":
+                inBlock = false
+                flush()
+            case "NO TRANSACTION":
+                m.NoTx = true
+            default:
+                return Migration{}, fmt.Errorf("unknown annotation %q", trimmed)
+            }
+            continue
+        }
+        if section == nil {
+            if len(trimmed) != 0 && !strings.HasPrefix(trimmed, "--") {
+                return Migration{}, errors.New("SQL before -- +goose Up")
+            }
+            continue
+        }
+        // comments between statements would otherwise start the next one
+        if stmt.Len() == 0 && (len(trimmed) == 0 || strings.HasPrefix(trimmed, "--")) {
+            continue
+        }
+
+        stmt.WriteString(line)
+        stmt.WriteString("\n")
+        if !inBlock && strings.HasSuffix(trimmed, ";") {
+            flush()
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return Migration{}, err
+    }
+    if inBlock {
+        return Migration{}, errors.New("StatementBegin without StatementEnd")
+    }
+    flush()
+
+    if section == nil {
+        return Migration{}, errors.New("no -- +goose Up section")
+    }
+    return m, nil
+}
+
+// Record is one row of goose_db_version.
+type Record struct {
+    Version int64
+    Applied bool
+    At time.Time
+}
+
+// Current works out the version from goose_db_version rows, newest first:
+// the newest applied row that hasn't been rolled back since.
+func Current(records []Record) int64 {
+    rolledBack := map[int64]bool{}
+    for _, r := range records {
+        if rolledBack[r.Version] {
+            continue
+        }
+        if !r.Applied {
+            rolledBack[r.Version] = true
+            continue
+        }
+        return r.Version
+    }
+    return 0
+}
+
+// appliedAt maps every applied version to when it was applied, again from
+// rows newest first.
+func appliedAt(records []Record) map[int64]time.Time {
+    decided := map[int64]bool{}
+    applied := map[int64]time.Time{}
+    for _, r := range records {
+        if decided[r.Version] {
+            continue
+        }
+        decided[r.Version] = true
+        if r.Applied {
+            applied[r.Version] = r.At
+        }
+    }
+    return applied
+}
+
+// Pending returns the migrations that still have to run, in order. It
+// refuses when one older than the current version is missing, which happens
+// when branches with new migrations get merged in the wrong order.
+func Pending(migrations []Migration, records []Record) ([]Migration, error) {
+    current := Current(records)
+    applied := appliedAt(records)
+
+    pending := []Migration{}
+    for _, m := range migrations {
+        if _, ok := applied[m.Version]; ok {
+            continue
+        }
+        if m.Version < current {
+            return nil, fmt.Errorf("migration %s is older than the current version %d but was never applied", m.Name, current)
+        }
+        pending = append(pending, m)
+    }
+    return pending, nil
+}
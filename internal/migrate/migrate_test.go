@@ -0,0 +1,169 @@
+package migrate_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/trice/Chirpy/internal/migrate"
+	"github.com/trice/Chirpy/sql/schema"
+)
+
+func TestParse(t *testing.T) {
+    text := `-- +goose Up
+CREATE TABLE chirps (
+    id UUID PRIMARY KEY
+);
+
+-- a comment between statements
+CREATE INDEX chirps_id ON chirps (id);
+
+-- +goose StatementBegin
+CREATE FUNCTION touch() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE chirps;
+`
+    m, err := migrate.Parse(text)
+    if err != nil {
+        t.Fatalf("Parse() error = %v", err)
+    }
+    if len(m.Up) != 3 {
+        t.Fatalf("Up has %d statements, want 3: %q", len(m.Up), m.Up)
+    }
+    if !strings.HasPrefix(m.Up[1], "CREATE INDEX") {
+        t.Errorf("second statement = %q", m.Up[1])
+    }
+    if !strings.Contains(m.Up[2], "RETURN NEW;") || !strings.HasSuffix(m.Up[2], "plpgsql;") {
+        t.Errorf("function body was split: %q", m.Up[2])
+    }
+    if len(m.Down) != 1 || m.Down[0] != "DROP TABLE chirps;" {
+        t.Errorf("Down = %q", m.Down)
+    }
+}
+
+func TestParseErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        text string
+    }{
+        { "No up", "CREATE TABLE x ();" },
+        { "Unclosed block", "-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n" },
+        { "Typo", "-- +goose up\nSELECT 1;\n" },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := migrate.Parse(tt.text)
+            if err == nil {
+                t.Errorf("Parse() accepted %q", tt.text)
+            }
+        })
+    }
+}
+
+func TestLoadEmbeddedSchema(t *testing.T) {
+    migrations, err := migrate.Load(schema.FS)
+    if err != nil {
+        t.Fatalf("Load() error = %v", err)
+    }
+    for i, m := range migrations {
+        if m.Version != int64(i + 1) {
+            t.Errorf("migration %d is %s, versions should have no gaps", i, m.Name)
+        }
+        if len(m.Up) == 0 || len(m.Down) == 0 {
+            t.Errorf("%s is missing up or down statements", m.Name)
+        }
+    }
+}
+
+func TestLoadDuplicateVersion(t *testing.T) {
+    fsys := fstest.MapFS {
+        "001_users.sql": { Data: []byte("-- +goose Up\nSELECT 1;\n") },
+        "01_chirps.sql": { Data: []byte("-- +goose Up\nSELECT 1;\n") },
+    }
+    _, err := migrate.Load(fsys)
+    if err == nil {
+        t.Errorf("Load() accepted two migrations with version 1")
+    }
+}
+
+func TestPending(t *testing.T) {
+    migrations := []migrate.Migration {
+        { Version: 1, Name: "001_users" },
+        { Version: 2, Name: "002_chirps" },
+        { Version: 3, Name: "003_tokens" },
+    }
+
+    tests := []struct {
+        name    string
+        records []migrate.Record
+        current int64
+        pending []int64
+        wantErr bool
+    }{
+        {
+            name:    "Fresh database",
+            records: []migrate.Record{ { Version: 0, Applied: true } },
+            current: 0,
+            pending: []int64{ 1, 2, 3 },
+        },
+        {
+            name: "Partly applied",
+            records: []migrate.Record {
+                { Version: 2, Applied: true },
+                { Version: 1, Applied: true },
+                { Version: 0, Applied: true },
+            },
+            current: 2,
+            pending: []int64{ 3 },
+        },
+        {
+            name: "Rolled back by an old goose",
+            records: []migrate.Record {
+                { Version: 2, Applied: false },
+                { Version: 2, Applied: true },
+                { Version: 1, Applied: true },
+                { Version: 0, Applied: true },
+            },
+            current: 1,
+            pending: []int64{ 2, 3 },
+        },
+        {
+            name: "Missing older migration",
+            records: []migrate.Record {
+                { Version: 3, Applied: true },
+                { Version: 1, Applied: true },
+                { Version: 0, Applied: true },
+            },
+            current: 3,
+            wantErr: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := migrate.Current(tt.records); got != tt.current {
+                t.Errorf("Current() = %d, want %d", got, tt.current)
+            }
+            pending, err := migrate.Pending(migrations, tt.records)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("Pending() error = %v, wantErr %v", err, tt.wantErr)
+            }
+            got := []int64{}
+            for _, m := range pending {
+                got = append(got, m.Version)
+            }
+            if !tt.wantErr && !slices.Equal(got, tt.pending) {
+                t.Errorf("Pending() = %v, want %v", got, tt.pending)
+            }
+        })
+    }
+}
@@ -0,0 +1,254 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// lockKey is the Postgres advisory lock held while migrating, so replicas
+// starting together with auto-migrate on take turns.
+const lockKey = 7_283_001
+
+// Migrator runs Migrations against DB.
+type Migrator struct {
+    DB *sql.DB
+    Migrations []Migration
+}
+
+// Status is a migration and whether it has been applied.
+type Status struct {
+    Migration
+    Applied bool
+    AppliedAt time.Time
+}
+
+// Latest is the version the migrations bring the database to.
+func (m *Migrator) Latest() int64 {
+    if len(m.Migrations) == 0 {
+        return 0
+    }
+    return m.Migrations[len(m.Migrations) - 1].Version
+}
+
+type queryer interface {
+    QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func records(ctx context.Context, q queryer) ([]Record, error) {
+    rows, err := q.QueryContext(ctx, "SELECT version_id, is_applied, tstamp FROM goose_db_version ORDER BY id DESC")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    out := []Record{}
+    for rows.Next() {
+        r := Record{}
+        at := sql.NullTime{}
+        err = rows.Scan(&r.Version, &r.Applied, &at)
+        if err != nil {
+            return nil, err
+        }
+        r.At = at.Time
+        out = append(out, r)
+    }
+    return out, rows.Err()
+}
+
+// Version returns the database's current version without changing
+// anything, not even creating the version table.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+    recs, err := records(ctx, m.DB)
+    if err != nil {
+        return 0, err
+    }
+    return Current(recs), nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+    recs, err := records(ctx, m.DB)
+    if err != nil {
+        return nil, err
+    }
+    applied := appliedAt(recs)
+
+    out := []Status{}
+    for _, mig := range m.Migrations {
+        at, ok := applied[mig.Version]
+        out = append(out, Status{ Migration: mig, Applied: ok, AppliedAt: at })
+    }
+    return out, nil
+}
+
+// Up applies every pending migration and returns those it applied. It
+// stops at the first that fails, leaving the ones before it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+    done := []Migration{}
+    err := m.locked(ctx, func(conn *sql.Conn) error {
+        recs, err := records(ctx, conn)
+        if err != nil {
+            return err
+        }
+        pending, err := Pending(m.Migrations, recs)
+        if err != nil {
+            return err
+        }
+        for _, mig := range pending {
+            err = apply(ctx, conn, mig, true)
+            if err != nil {
+                return err
+            }
+            done = append(done, mig)
+        }
+        return nil
+    })
+    return done, err
+}
+
+// Down rolls back the current version.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+    var rolledBack Migration
+    err := m.locked(ctx, func(conn *sql.Conn) error {
+        mig, err := m.current(ctx, conn)
+        if err != nil {
+            return err
+        }
+        rolledBack = mig
+        return apply(ctx, conn, mig, false)
+    })
+    return rolledBack, err
+}
+
+// Redo rolls back the current version and applies it again, handy while
+// writing a migration.
+func (m *Migrator) Redo(ctx context.Context) (Migration, error) {
+    var redone Migration
+    err := m.locked(ctx, func(conn *sql.Conn) error {
+        mig, err := m.current(ctx, conn)
+        if err != nil {
+            return err
+        }
+        redone = mig
+        err = apply(ctx, conn, mig, false)
+        if err != nil {
+            return err
+        }
+        return apply(ctx, conn, mig, true)
+    })
+    return redone, err
+}
+
+func (m *Migrator) current(ctx context.Context, conn *sql.Conn) (Migration, error) {
+    recs, err := records(ctx, conn)
+    if err != nil {
+        return Migration{}, err
+    }
+    version := Current(recs)
+    if version == 0 {
+        return Migration{}, errors.New("no migrations applied")
+    }
+    for _, mig := range m.Migrations {
+        if mig.Version == version {
+            return mig, nil
+        }
+    }
+    return Migration{}, fmt.Errorf("no migration file for the current version %d", version)
+}
+
+// locked runs fn on one connection holding the advisory lock, after
+// making sure the version table exists.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+    conn, err := m.DB.Conn(ctx)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+
+    _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey)
+    if err != nil {
+        return err
+    }
+    // not ctx, the lock has to go even when ctx was cancelled
+    defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+
+    err = ensureVersionTable(ctx, conn)
+    if err != nil {
+        return err
+    }
+    return fn(conn)
+}
+
+// ensureVersionTable creates goose_db_version the way goose does,
+// including the row for version 0.
+func ensureVersionTable(ctx context.Context, conn *sql.Conn) error {
+    _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS goose_db_version (
+        id serial NOT NULL,
+        version_id bigint NOT NULL,
+        is_applied boolean NOT NULL,
+        tstamp timestamp NULL default now(),
+        PRIMARY KEY(id)
+    )`)
+    if err != nil {
+        return err
+    }
+    _, err = conn.ExecContext(ctx, `INSERT INTO goose_db_version (version_id, is_applied)
+        SELECT 0, true WHERE NOT EXISTS (SELECT 1 FROM goose_db_version)`)
+    return err
+}
+
+// apply runs one direction of mig and records it like goose: a row when
+// going up, deleting the version's rows when going down.
+func apply(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+    stmts := mig.Down
+    record := "DELETE FROM goose_db_version WHERE version_id = $1"
+    args := []any{ mig.Version }
+    if up {
+        stmts = mig.Up
+        record = "INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, true)"
+    }
+
+    wrap := func(err error) error {
+        direction := "down"
+        if up {
+            direction = "up"
+        }
+        return fmt.Errorf("migrating %s %s: %w", mig.Name, direction, err)
+    }
+
+    if mig.NoTx {
+        for _, stmt := range stmts {
+            _, err := conn.ExecContext(ctx, stmt)
+            if err != nil {
+                return wrap(err)
+            }
+        }
+        _, err := conn.ExecContext(ctx, record, args...)
+        if err != nil {
+            return wrap(err)
+        }
+        return nil
+    }
+
+    tx, err := conn.BeginTx(ctx, nil)
+    if err != nil {
+        return wrap(err)
+    }
+    defer tx.Rollback()
+    for _, stmt := range stmts {
+        _, err = tx.ExecContext(ctx, stmt)
+        if err != nil {
+            return wrap(err)
+        }
+    }
+    _, err = tx.ExecContext(ctx, record, args...)
+    if err == nil {
+        err = tx.Commit()
+    }
+    if err != nil {
+        return wrap(err)
+    }
+    return nil
+}
@@ -0,0 +1,72 @@
+package oidc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const flowIssuer = "chirpy-oidc"
+
+// Flow is what has to survive the round trip through the provider. It is
+// kept client side in a signed cookie so any instance can finish the login.
+type Flow struct {
+    Provider string `json:"provider"`
+    State string `json:"state"`
+    Nonce string `json:"nonce"`
+    Verifier string `json:"verifier"`
+}
+
+type flowClaims struct {
+    jwt.RegisteredClaims
+    Flow
+}
+
+// NewFlow creates fresh state, nonce and PKCE verifier for provider.
+func NewFlow(provider string) (Flow, error) {
+    f := Flow{ Provider: provider }
+    var err error
+    if f.State, err = RandomString(); err != nil {
+        return Flow{}, err
+    }
+    if f.Nonce, err = RandomString(); err != nil {
+        return Flow{}, err
+    }
+    if f.Verifier, err = RandomString(); err != nil {
+        return Flow{}, err
+    }
+    return f, nil
+}
+
+func MakeFlowToken(f Flow, tokenSecret string, expiresIn time.Duration) (string, error) {
+    if len(tokenSecret) == 0 {
+        return "", fmt.Errorf("Invalid tokenSecret")
+    }
+
+    now := time.Now().UTC()
+    claims := flowClaims {
+        RegisteredClaims: jwt.RegisteredClaims {
+            Issuer: flowIssuer,
+            IssuedAt: jwt.NewNumericDate(now),
+            ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+        },
+        Flow: f,
+    }
+    return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(tokenSecret))
+}
+
+func ParseFlowToken(tokenString, tokenSecret string) (Flow, error) {
+    if len(tokenSecret) == 0 {
+        return Flow{}, fmt.Errorf("Invalid tokenSecret")
+    }
+
+    claims := flowClaims{}
+    _, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (any, error) {
+        return []byte(tokenSecret), nil
+    }, jwt.WithValidMethods([]string{"HS256"}), jwt.WithIssuer(flowIssuer))
+    if err != nil {
+        return Flow{}, fmt.Errorf("Failed to parse flow token")
+    }
+    return claims.Flow, nil
+}
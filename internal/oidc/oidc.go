@@ -0,0 +1,268 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Provider is an external OpenID Connect identity provider. Endpoints are
+// found through discovery on first use so only the issuer URL is configured.
+type Provider struct {
+    Name string
+    Issuer string
+    ClientID string
+    ClientSecret string
+    RedirectURL string
+    Scopes []string
+    Client *http.Client
+
+    mu sync.Mutex
+    meta *metadata
+    keys map[string]*rsa.PublicKey
+}
+
+type metadata struct {
+    Issuer string `json:"issuer"`
+    AuthorizationEndpoint string `json:"authorization_endpoint"`
+    TokenEndpoint string `json:"token_endpoint"`
+    JWKSURI string `json:"jwks_uri"`
+}
+
+// Claims are the parts of the ID token Chirpy cares about.
+type Claims struct {
+    jwt.RegisteredClaims
+    Email string `json:"email"`
+    EmailVerified bool `json:"email_verified"`
+    Nonce string `json:"nonce"`
+}
+
+func (p *Provider) httpClient() *http.Client {
+    if p.Client != nil {
+        return p.Client
+    }
+    return http.DefaultClient
+}
+
+func (p *Provider) scopes() string {
+    if len(p.Scopes) == 0 {
+        return "openid email"
+    }
+    return strings.Join(p.Scopes, " ")
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v any) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+    if err != nil {
+        return err
+    }
+    resp, err := p.httpClient().Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("GET %s returned %d", u, resp.StatusCode)
+    }
+    return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.meta != nil {
+        return p.meta, nil
+    }
+
+    m := metadata{}
+    err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration", &m)
+    if err != nil {
+        return nil, err
+    }
+
+    // per the spec the discovered issuer has to match the configured one
+    if m.Issuer != p.Issuer {
+        return nil, fmt.Errorf("Issuer mismatch: %s", m.Issuer)
+    }
+    p.meta = &m
+    return p.meta, nil
+}
+
+// AuthCodeURL returns the URL to send the browser to for the authorization
+// code flow with a PKCE S256 challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+    m, err := p.discover(ctx)
+    if err != nil {
+        return "", err
+    }
+
+    v := url.Values{}
+    v.Set("response_type", "code")
+    v.Set("client_id", p.ClientID)
+    v.Set("redirect_uri", p.RedirectURL)
+    v.Set("scope", p.scopes())
+    v.Set("state", state)
+    v.Set("nonce", nonce)
+    v.Set("code_challenge", challenge)
+    v.Set("code_challenge_method", "S256")
+
+    sep := "?"
+    if strings.Contains(m.AuthorizationEndpoint, "?") {
+        sep = "&"
+    }
+    return m.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the claims
+// of the verified ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+    m, err := p.discover(ctx)
+    if err != nil {
+        return Claims{}, err
+    }
+
+    form := url.Values{}
+    form.Set("grant_type", "authorization_code")
+    form.Set("code", code)
+    form.Set("redirect_uri", p.RedirectURL)
+    form.Set("code_verifier", verifier)
+    form.Set("client_id", p.ClientID)
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return Claims{}, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    if len(p.ClientSecret) != 0 {
+        req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+    }
+
+    resp, err := p.httpClient().Do(req)
+    if err != nil {
+        return Claims{}, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return Claims{}, fmt.Errorf("Token endpoint returned %d", resp.StatusCode)
+    }
+
+    tokens := struct {
+        IDToken string `json:"id_token"`
+    }{}
+    err = json.NewDecoder(resp.Body).Decode(&tokens)
+    if err != nil {
+        return Claims{}, err
+    }
+    if len(tokens.IDToken) == 0 {
+        return Claims{}, fmt.Errorf("No id_token in token response")
+    }
+
+    return p.verify(ctx, m, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, m *metadata, idToken, nonce string) (Claims, error) {
+    claims := Claims{}
+    _, err := jwt.ParseWithClaims(idToken, &claims, func(t *jwt.Token) (any, error) {
+        kid, _ := t.Header["kid"].(string)
+        return p.key(ctx, m, kid)
+    }, jwt.WithValidMethods([]string{"RS256"}),
+       jwt.WithIssuer(m.Issuer),
+       jwt.WithAudience(p.ClientID),
+       jwt.WithExpirationRequired(),
+       jwt.WithLeeway(30 * time.Second))
+    if err != nil {
+        return Claims{}, fmt.Errorf("Invalid id_token: %w", err)
+    }
+
+    if claims.Nonce != nonce {
+        return Claims{}, fmt.Errorf("Invalid id_token nonce")
+    }
+    if len(claims.Subject) == 0 {
+        return Claims{}, fmt.Errorf("Invalid id_token subject")
+    }
+    return claims, nil
+}
+
+// key looks up a signing key by id, fetching the JWKS again when the id is
+// unknown since providers rotate keys
+func (p *Provider) key(ctx context.Context, m *metadata, kid string) (*rsa.PublicKey, error) {
+    p.mu.Lock()
+    k, ok := p.keys[kid]
+    p.mu.Unlock()
+    if ok {
+        return k, nil
+    }
+
+    jwks := struct {
+        Keys []struct {
+            Kid string `json:"kid"`
+            Kty string `json:"kty"`
+            N string `json:"n"`
+            E string `json:"e"`
+        } `json:"keys"`
+    }{}
+    err := p.getJSON(ctx, m.JWKSURI, &jwks)
+    if err != nil {
+        return nil, err
+    }
+
+    keys := map[string]*rsa.PublicKey{}
+    for _, jwk := range jwks.Keys {
+        if jwk.Kty != "RSA" {
+            continue
+        }
+        n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+        if err != nil {
+            continue
+        }
+        e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+        if err != nil {
+            continue
+        }
+        keys[jwk.Kid] = &rsa.PublicKey{
+            N: new(big.Int).SetBytes(n),
+            E: int(new(big.Int).SetBytes(e).Int64()),
+        }
+    }
+
+    p.mu.Lock()
+    p.keys = keys
+    p.mu.Unlock()
+
+    k, ok = keys[kid]
+    if !ok {
+        return nil, fmt.Errorf("Unknown signing key %q", kid)
+    }
+    return k, nil
+}
+
+// RandomString returns 32 random bytes, base64url encoded, good for state,
+// nonce and PKCE verifiers.
+func RandomString() (string, error) {
+    buf := make([]byte, 32)
+    _, err := rand.Read(buf)
+    if err != nil {
+        return "", err
+    }
+    return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// PKCEChallenge is the S256 code challenge for verifier.
+func PKCEChallenge(verifier string) string {
+    sum := sha256.Sum256([]byte(verifier))
+    return base64.RawURLEncoding.EncodeToString(sum[:])
+}
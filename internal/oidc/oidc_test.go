@@ -0,0 +1,205 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/trice/Chirpy/internal/oidc"
+)
+
+// stubIdP is a tiny OpenID provider that remembers the PKCE challenge and
+// nonce of the last authorization request, enough to run a full login.
+type stubIdP struct {
+    server *httptest.Server
+    key *rsa.PrivateKey
+    challenge string
+    nonce string
+    audience string
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatalf("GenerateKey() error = %v", err)
+    }
+    idp := &stubIdP{ key: key, audience: "chirpy-client" }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+        json.NewEncoder(w).Encode(map[string]string{
+            "issuer": idp.server.URL,
+            "authorization_endpoint": idp.server.URL + "/authorize",
+            "token_endpoint": idp.server.URL + "/token",
+            "jwks_uri": idp.server.URL + "/jwks",
+        })
+    })
+    mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+        json.NewEncoder(w).Encode(map[string]any{
+            "keys": []map[string]string{{
+                "kid": "test-key",
+                "kty": "RSA",
+                "n": base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+                "e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+            }},
+        })
+    })
+    mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+        idp.challenge = r.URL.Query().Get("code_challenge")
+        idp.nonce = r.URL.Query().Get("nonce")
+        redirect := r.URL.Query().Get("redirect_uri") + "?code=the-code&state=" + url.QueryEscape(r.URL.Query().Get("state"))
+        http.Redirect(w, r, redirect, http.StatusFound)
+    })
+    mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+        r.ParseForm()
+        if r.Form.Get("code") != "the-code" || oidc.PKCEChallenge(r.Form.Get("code_verifier")) != idp.challenge {
+            w.WriteHeader(http.StatusBadRequest)
+            return
+        }
+
+        claims := oidc.Claims {
+            RegisteredClaims: jwt.RegisteredClaims {
+                Issuer: idp.server.URL,
+                Subject: "subject-1",
+                Audience: jwt.ClaimStrings{ idp.audience },
+                ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+            },
+            Email: "walt@breakingbad.com",
+            EmailVerified: true,
+            Nonce: idp.nonce,
+        }
+        token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+        token.Header["kid"] = "test-key"
+        idToken, _ := token.SignedString(idp.key)
+        json.NewEncoder(w).Encode(map[string]string{ "id_token": idToken })
+    })
+
+    idp.server = httptest.NewServer(mux)
+    t.Cleanup(idp.server.Close)
+    return idp
+}
+
+// runFlow drives the authorization request like a browser would and returns
+// the code and state that came back on the redirect
+func runFlow(t *testing.T, p *oidc.Provider, f oidc.Flow) (string, string) {
+    authURL, err := p.AuthCodeURL(context.Background(), f.State, f.Nonce, oidc.PKCEChallenge(f.Verifier))
+    if err != nil {
+        t.Fatalf("AuthCodeURL() error = %v", err)
+    }
+
+    client := &http.Client{ CheckRedirect: func(*http.Request, []*http.Request) error {
+        return http.ErrUseLastResponse
+    }}
+    resp, err := client.Get(authURL)
+    if err != nil {
+        t.Fatalf("authorize error = %v", err)
+    }
+    resp.Body.Close()
+
+    loc, _ := url.Parse(resp.Header.Get("Location"))
+    return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+    tests := []struct {
+        name        string
+        audience    string
+        verifier    string
+        nonce       string
+        expectError bool
+    }{
+        {
+            name:        "Valid login",
+            audience:    "chirpy-client",
+            expectError: false,
+        },
+        {
+            name:        "Wrong PKCE verifier",
+            audience:    "chirpy-client",
+            verifier:    "not-the-verifier",
+            expectError: true,
+        },
+        {
+            name:        "Wrong nonce",
+            audience:    "chirpy-client",
+            nonce:       "not-the-nonce",
+            expectError: true,
+        },
+        {
+            name:        "Token for another client",
+            audience:    "someone-else",
+            expectError: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            idp := newStubIdP(t)
+            idp.audience = tt.audience
+            p := &oidc.Provider {
+                Name: "stub",
+                Issuer: idp.server.URL,
+                ClientID: "chirpy-client",
+                ClientSecret: "shh",
+                RedirectURL: "http://localhost:8080/api/auth/stub/callback",
+            }
+
+            f, err := oidc.NewFlow("stub")
+            if err != nil {
+                t.Fatalf("NewFlow() error = %v", err)
+            }
+            code, state := runFlow(t, p, f)
+            if state != f.State {
+                t.Fatalf("state = %v, want %v", state, f.State)
+            }
+
+            verifier := f.Verifier
+            if len(tt.verifier) != 0 {
+                verifier = tt.verifier
+            }
+            nonce := f.Nonce
+            if len(tt.nonce) != 0 {
+                nonce = tt.nonce
+            }
+
+            claims, err := p.Exchange(context.Background(), code, verifier, nonce)
+            if (err != nil) != tt.expectError {
+                t.Fatalf("Exchange() error = %v, expectError %v", err, tt.expectError)
+            }
+            if !tt.expectError && (claims.Subject != "subject-1" || claims.Email != "walt@breakingbad.com") {
+                t.Errorf("Exchange() claims = %+v", claims)
+            }
+        })
+    }
+}
+
+func TestFlowToken(t *testing.T) {
+    f, err := oidc.NewFlow("stub")
+    if err != nil {
+        t.Fatalf("NewFlow() error = %v", err)
+    }
+
+    tok, err := oidc.MakeFlowToken(f, "test-secret", time.Minute)
+    if err != nil {
+        t.Fatalf("MakeFlowToken() error = %v", err)
+    }
+
+    got, err := oidc.ParseFlowToken(tok, "test-secret")
+    if err != nil || got != f {
+        t.Errorf("ParseFlowToken() = %+v, %v, want %+v", got, err, f)
+    }
+
+    _, err = oidc.ParseFlowToken(tok, "wrong-secret")
+    if err == nil {
+        t.Errorf("ParseFlowToken() accepted the wrong secret")
+    }
+}
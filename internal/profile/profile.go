@@ -0,0 +1,70 @@
+// Package profile holds the public side of a user: what anyone may see
+// about them, and the rules for the parts they can edit.
+package profile
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+    MaxDisplayName = 50
+    MaxBio = 160
+    MaxAvatarURL = 500
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// Public is a user as everyone else sees them. It never has the email.
+type Public struct {
+    ID uuid.UUID `json:"id"`
+    Username string `json:"username,omitempty"`
+    DisplayName string `json:"display_name"`
+    Bio string `json:"bio"`
+    AvatarURL string `json:"avatar_url"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// Fields are the parts of a profile the user edits.
+type Fields struct {
+    Username string
+    DisplayName string
+    Bio string
+    AvatarURL string
+}
+
+// Clean trims the fields and checks them. An empty username means the user
+// has none, usernames keep their case but are unique regardless of it.
+func (f Fields) Clean() (Fields, error) {
+    f.Username = strings.TrimSpace(f.Username)
+    f.DisplayName = strings.TrimSpace(f.DisplayName)
+    f.Bio = strings.TrimSpace(f.Bio)
+    f.AvatarURL = strings.TrimSpace(f.AvatarURL)
+
+    if len(f.Username) != 0 && !usernamePattern.MatchString(f.Username) {
+        return f, errors.New("username must be 3 to 30 letters, digits or underscores")
+    }
+    if utf8.RuneCountInString(f.DisplayName) > MaxDisplayName {
+        return f, errors.New("display name is too long")
+    }
+    if utf8.RuneCountInString(f.Bio) > MaxBio {
+        return f, errors.New("bio is too long")
+    }
+    if len(f.AvatarURL) != 0 {
+        if len(f.AvatarURL) > MaxAvatarURL {
+            return f, errors.New("avatar url is too long")
+        }
+        // only plain https links, anything else could run in a client
+        u, err := url.Parse(f.AvatarURL)
+        if err != nil || u.Scheme != "https" || len(u.Host) == 0 || u.User != nil {
+            return f, errors.New("avatar url must be an https url")
+        }
+    }
+    return f, nil
+}
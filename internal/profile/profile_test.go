@@ -0,0 +1,80 @@
+package profile_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/trice/Chirpy/internal/profile"
+)
+
+func TestFieldsClean(t *testing.T) {
+    tests := []struct {
+        name    string
+        fields  profile.Fields
+        want    profile.Fields
+        wantErr bool
+    }{
+        {
+            name:   "Everything set",
+            fields: profile.Fields{ Username: " Jane_Doe ", DisplayName: "Jane", Bio: "hi", AvatarURL: "https://example.com/jane.png" },
+            want:   profile.Fields{ Username: "Jane_Doe", DisplayName: "Jane", Bio: "hi", AvatarURL: "https://example.com/jane.png" },
+        },
+        {
+            name:   "Nothing set",
+            fields: profile.Fields{},
+            want:   profile.Fields{},
+        },
+        {
+            name:    "Username too short",
+            fields:  profile.Fields{ Username: "jd" },
+            wantErr: true,
+        },
+        {
+            name:    "Username with spaces",
+            fields:  profile.Fields{ Username: "jane doe" },
+            wantErr: true,
+        },
+        {
+            name:    "Username with an at sign",
+            fields:  profile.Fields{ Username: "jane@example.com" },
+            wantErr: true,
+        },
+        {
+            name:   "Display name at the limit",
+            fields: profile.Fields{ DisplayName: strings.Repeat("é", profile.MaxDisplayName) },
+            want:   profile.Fields{ DisplayName: strings.Repeat("é", profile.MaxDisplayName) },
+        },
+        {
+            name:    "Bio too long",
+            fields:  profile.Fields{ Bio: strings.Repeat("a", profile.MaxBio + 1) },
+            wantErr: true,
+        },
+        {
+            name:    "Avatar over http",
+            fields:  profile.Fields{ AvatarURL: "http://example.com/a.png" },
+            wantErr: true,
+        },
+        {
+            name:    "Avatar javascript url",
+            fields:  profile.Fields{ AvatarURL: "javascript:alert(1)" },
+            wantErr: true,
+        },
+        {
+            name:    "Avatar with credentials",
+            fields:  profile.Fields{ AvatarURL: "https://user:pw@example.com/a.png" },
+            wantErr: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := tt.fields.Clean()
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("Clean() error = %v, wantErr %v", err, tt.wantErr)
+            }
+            if !tt.wantErr && got != tt.want {
+                t.Errorf("Clean() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
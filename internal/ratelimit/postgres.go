@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/trice/Chirpy/internal/database"
+)
+
+// PostgresStore shares buckets between instances through the
+// rate_limit_buckets table.
+type PostgresStore struct {
+    Queries *database.Queries
+}
+
+func (s PostgresStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+    param := database.TakeRateLimitTokenParams {
+        Key: key,
+        Now: now.UTC(),
+        IntervalSecs: limit.interval().Seconds(),
+        BurstSecs: limit.tolerance().Seconds(),
+    }
+
+    // the upsert only touches the row when a token is available, so no row
+    // back means the request is over the limit
+    tat, err := s.Queries.TakeRateLimitToken(ctx, param)
+    if err == nil {
+        _, res := gcra(tat.Add(-limit.interval()), now.UTC(), limit)
+        return res, nil
+    }
+    if !errors.Is(err, sql.ErrNoRows) {
+        return Result{}, err
+    }
+
+    tat, err = s.Queries.GetRateLimitTAT(ctx, key)
+    if err != nil {
+        return Result{}, err
+    }
+    _, res := gcra(tat, now.UTC(), limit)
+    return res, nil
+}
+
+// Sweep deletes buckets that are full again and so carry no state.
+func (s PostgresStore) Sweep(ctx context.Context, now time.Time) (int64, error) {
+    return s.Queries.DeleteFullRateLimitBuckets(ctx, now.UTC())
+}
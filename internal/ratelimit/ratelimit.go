@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilling at Rate tokens per Per, holding at
+// most Burst tokens.
+type Limit struct {
+    Rate int
+    Per time.Duration
+    Burst int
+}
+
+func PerMinute(n int) Limit {
+    return Limit{ Rate: n, Per: time.Minute, Burst: n }
+}
+
+// ParseLimit reads limits written like "5/m", "100/h" or "10/s".
+func ParseLimit(s string) (Limit, error) {
+    n, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+    rate, err := strconv.Atoi(n)
+    if !ok || err != nil || rate <= 0 {
+        return Limit{}, fmt.Errorf("Invalid limit %q", s)
+    }
+
+    per := map[string]time.Duration{ "s": time.Second, "m": time.Minute, "h": time.Hour }[unit]
+    if per == 0 {
+        return Limit{}, fmt.Errorf("Invalid limit unit %q", unit)
+    }
+    return Limit{ Rate: rate, Per: per, Burst: rate }, nil
+}
+
+// interval between two tokens
+func (l Limit) interval() time.Duration {
+    return l.Per / time.Duration(l.Rate)
+}
+
+// tolerance is how far ahead of now the bucket may run, i.e. a full burst
+func (l Limit) tolerance() time.Duration {
+    return l.interval() * time.Duration(l.Burst)
+}
+
+type Result struct {
+    Allowed bool
+    Limit int
+    Remaining int
+    // RetryAfter is how long to wait before the next request can succeed
+    RetryAfter time.Duration
+    // Reset is how long until the bucket is full again
+    Reset time.Duration
+}
+
+// Store keeps the buckets. Take removes a token from the bucket for key if
+// there is one.
+type Store interface {
+    Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// The buckets are tracked GCRA style: instead of a token count each key only
+// stores the theoretical arrival time (TAT) at which its bucket is full
+// again. It behaves exactly like a token bucket but is a single timestamp,
+// which keeps the Postgres version down to one atomic upsert.
+func gcra(tat, now time.Time, limit Limit) (time.Time, Result) {
+    if tat.Before(now) {
+        tat = now
+    }
+    newTat := tat.Add(limit.interval())
+    ahead := newTat.Sub(now)
+
+    if ahead > limit.tolerance() {
+        return tat, Result {
+            Allowed: false,
+            Limit: limit.Burst,
+            Remaining: 0,
+            RetryAfter: ahead - limit.tolerance(),
+            Reset: tat.Sub(now),
+        }
+    }
+
+    return newTat, Result {
+        Allowed: true,
+        Limit: limit.Burst,
+        Remaining: int((limit.tolerance() - ahead) / limit.interval()),
+        Reset: ahead,
+    }
+}
+
+// MemoryStore keeps buckets in process, fine for a single instance.
+type MemoryStore struct {
+    mu sync.Mutex
+    tats map[string]time.Time
+    takes int
+}
+
+func NewMemoryStore() *MemoryStore {
+    return &MemoryStore{ tats: map[string]time.Time{} }
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    tat, res := gcra(s.tats[key], now, limit)
+    s.tats[key] = tat
+
+    // buckets that have filled up again carry no state, drop them now and then
+    s.takes++
+    if s.takes % 1000 == 0 {
+        for k, t := range s.tats {
+            if t.Before(now) {
+                delete(s.tats, k)
+            }
+        }
+    }
+    return res, nil
+}
+
+// KeyFunc picks the bucket for a request.
+type KeyFunc func(r *http.Request) string
+
+// Middleware limits next to limit per key. Keys are prefixed with route so
+// every route gets buckets of its own. If the store fails the request is let
+// through, an outage of the limiter shouldn't take the API down with it.
+func Middleware(store Store, route string, limit Limit, key KeyFunc, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        res, err := store.Take(r.Context(), route + ":" + key(r), limit, time.Now())
+        if err != nil {
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+        w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+        w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+
+        if !res.Allowed {
+            w.Header().Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+            w.Header().Set("Content-Type", "application/json; charset=utf-8")
+            w.WriteHeader(http.StatusTooManyRequests)
+            w.Write([]byte(`{"error":"rate limit exceeded"}`))
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+func seconds(d time.Duration) int {
+    return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP returns the address of the client. X-Forwarded-For is only
+// believed behind a trusted proxy, otherwise anyone could pick their bucket.
+func ClientIP(r *http.Request, trustProxy bool) string {
+    if trustProxy {
+        if fwd := r.Header.Get("X-Forwarded-For"); len(fwd) != 0 {
+            first, _, _ := strings.Cut(fwd, ",")
+            return strings.TrimSpace(first)
+        }
+    }
+
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
@@ -0,0 +1,117 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/trice/Chirpy/internal/ratelimit"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+    store := ratelimit.NewMemoryStore()
+    limit := ratelimit.PerMinute(3)
+    now := time.Unix(1700000000, 0)
+
+    // a full bucket allows a burst, then has to refill
+    for i := 0; i < 3; i++ {
+        res, _ := store.Take(context.Background(), "k", limit, now)
+        if !res.Allowed || res.Remaining != 2 - i {
+            t.Fatalf("Take() #%d = %+v", i, res)
+        }
+    }
+
+    res, _ := store.Take(context.Background(), "k", limit, now)
+    if res.Allowed || res.RetryAfter != 20 * time.Second {
+        t.Errorf("Take() over the limit = %+v", res)
+    }
+
+    res, _ = store.Take(context.Background(), "other", limit, now)
+    if !res.Allowed {
+        t.Errorf("Take() on another key was limited")
+    }
+
+    res, _ = store.Take(context.Background(), "k", limit, now.Add(20 * time.Second))
+    if !res.Allowed || res.Remaining != 0 {
+        t.Errorf("Take() after one refill = %+v", res)
+    }
+}
+
+func TestParseLimit(t *testing.T) {
+    tests := []struct {
+        name        string
+        limit       string
+        expected    ratelimit.Limit
+        expectError bool
+    }{
+        {
+            name:     "Per minute",
+            limit:    "5/m",
+            expected: ratelimit.Limit{ Rate: 5, Per: time.Minute, Burst: 5 },
+        },
+        {
+            name:     "Per hour",
+            limit:    " 100/h ",
+            expected: ratelimit.Limit{ Rate: 100, Per: time.Hour, Burst: 100 },
+        },
+        {
+            name:        "Bad unit",
+            limit:       "5/d",
+            expectError: true,
+        },
+        {
+            name:        "Zero",
+            limit:       "0/s",
+            expectError: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := ratelimit.ParseLimit(tt.limit)
+            if (err != nil) != tt.expectError {
+                t.Errorf("ParseLimit() error = %v, expectError %v", err, tt.expectError)
+                return
+            }
+            if got != tt.expected {
+                t.Errorf("ParseLimit() = %+v, want %+v", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestMiddleware(t *testing.T) {
+    store := ratelimit.NewMemoryStore()
+    key := func(r *http.Request) string {
+        return ratelimit.ClientIP(r, false)
+    }
+    ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    })
+    handler := ratelimit.Middleware(store, "login", ratelimit.PerMinute(1), key, ok)
+
+    req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+    req.RemoteAddr = "192.0.2.1:1234"
+
+    rec := httptest.NewRecorder()
+    handler.ServeHTTP(rec, req)
+    if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Remaining") != "0" {
+        t.Fatalf("first request = %d, headers %v", rec.Code, rec.Header())
+    }
+
+    rec = httptest.NewRecorder()
+    handler.ServeHTTP(rec, req)
+    if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+        t.Errorf("second request = %d, headers %v", rec.Code, rec.Header())
+    }
+
+    // spoofing X-Forwarded-For doesn't get a fresh bucket
+    req.Header.Set("X-Forwarded-For", "198.51.100.7")
+    rec = httptest.NewRecorder()
+    handler.ServeHTTP(rec, req)
+    if rec.Code != http.StatusTooManyRequests {
+        t.Errorf("spoofed request = %d", rec.Code)
+    }
+}
@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter receives finished spans. Export must not block the request that
+// ended the span.
+type Exporter interface {
+    Export(span SpanData)
+    Shutdown(ctx context.Context) error
+}
+
+// WriterExporter writes every span as one line of OTLP JSON, which is handy
+// in tests and for eyeballing traces locally.
+type WriterExporter struct {
+    Out io.Writer
+    Service string
+
+    mu sync.Mutex
+}
+
+func (e *WriterExporter) Export(span SpanData) {
+    d, err := json.Marshal(otlpRequest(e.Service, []SpanData{ span }))
+    if err != nil {
+        return
+    }
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    e.Out.Write(append(d, '\n'))
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+    return nil
+}
+
+// OTLPExporter batches spans and posts them to an OTLP/HTTP collector using
+// the JSON encoding, e.g. to http://localhost:4318/v1/traces. Spans are
+// dropped rather than queued forever when the collector can't keep up.
+type OTLPExporter struct {
+    endpoint string
+    service string
+    client *http.Client
+
+    spans chan SpanData
+    done chan struct{}
+    stopOnce sync.Once
+    stop chan struct{}
+}
+
+const (
+    otlpQueueSize = 2048
+    otlpBatchSize = 256
+    otlpInterval = 5 * time.Second
+)
+
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+    e := &OTLPExporter {
+        endpoint: endpoint,
+        service: service,
+        client: &http.Client{ Timeout: 10 * time.Second },
+        spans: make(chan SpanData, otlpQueueSize),
+        done: make(chan struct{}),
+        stop: make(chan struct{}),
+    }
+    go e.run()
+    return e
+}
+
+func (e *OTLPExporter) Export(span SpanData) {
+    select {
+    case e.spans <- span:
+    default:
+    }
+}
+
+// Shutdown sends what is still queued and stops the exporter.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+    e.stopOnce.Do(func() { close(e.stop) })
+    select {
+    case <-e.done:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func (e *OTLPExporter) run() {
+    defer close(e.done)
+    ticker := time.NewTicker(otlpInterval)
+    defer ticker.Stop()
+
+    batch := []SpanData{}
+    for {
+        select {
+        case span := <-e.spans:
+            batch = append(batch, span)
+            if len(batch) < otlpBatchSize {
+                continue
+            }
+        case <-ticker.C:
+        case <-e.stop:
+            for {
+                select {
+                case span := <-e.spans:
+                    batch = append(batch, span)
+                    continue
+                default:
+                }
+                break
+            }
+            e.send(batch)
+            return
+        }
+        e.send(batch)
+        batch = batch[:0]
+    }
+}
+
+func (e *OTLPExporter) send(batch []SpanData) error {
+    if len(batch) == 0 {
+        return nil
+    }
+    d, err := json.Marshal(otlpRequest(e.service, batch))
+    if err != nil {
+        return err
+    }
+
+    resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(d))
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, resp.Body)
+    if resp.StatusCode/100 != 2 {
+        return fmt.Errorf("collector returned %s", resp.Status)
+    }
+    return nil
+}
+
+// the OTLP JSON encoding, see opentelemetry-proto's trace.proto
+
+type otlpKeyValue struct {
+    Key string `json:"key"`
+    Value map[string]any `json:"value"`
+}
+
+type otlpStatus struct {
+    Code int `json:"code"`
+    Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+    TraceID string `json:"traceId"`
+    SpanID string `json:"spanId"`
+    ParentSpanID string `json:"parentSpanId,omitempty"`
+    Name string `json:"name"`
+    Kind int `json:"kind"`
+    StartTimeUnixNano string `json:"startTimeUnixNano"`
+    EndTimeUnixNano string `json:"endTimeUnixNano"`
+    Attributes []otlpKeyValue `json:"attributes,omitempty"`
+    Status otlpStatus `json:"status"`
+}
+
+func otlpValue(v any) map[string]any {
+    switch v := v.(type) {
+    case int64:
+        // int64 is a string in the proto JSON mapping
+        return map[string]any{ "intValue": strconv.FormatInt(v, 10) }
+    case bool:
+        return map[string]any{ "boolValue": v }
+    default:
+        return map[string]any{ "stringValue": fmt.Sprint(v) }
+    }
+}
+
+func otlpRequest(service string, spans []SpanData) map[string]any {
+    out := make([]otlpSpan, 0, len(spans))
+    for _, s := range spans {
+        span := otlpSpan {
+            TraceID: s.TraceID.String(),
+            SpanID: s.SpanID.String(),
+            Name: s.Name,
+            Kind: int(s.Kind),
+            StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+            EndTimeUnixNano: strconv.FormatInt(s.End.UnixNano(), 10),
+        }
+        if s.Parent.IsValid() {
+            span.ParentSpanID = s.Parent.String()
+        }
+        for _, a := range s.Attributes {
+            span.Attributes = append(span.Attributes, otlpKeyValue{ a.Key, otlpValue(a.Value) })
+        }
+        if len(s.Error) != 0 {
+            span.Status = otlpStatus{ Code: 2, Message: s.Error }
+        }
+        out = append(out, span)
+    }
+
+    return map[string]any {
+        "resourceSpans": []any {
+            map[string]any {
+                "resource": map[string]any {
+                    "attributes": []otlpKeyValue{ { "service.name", otlpValue(service) } },
+                },
+                "scopeSpans": []any {
+                    map[string]any {
+                        "scope": map[string]any{ "name": "github.com/trice/Chirpy/internal/tracing" },
+                        "spans": out,
+                    },
+                },
+            },
+        },
+    }
+}
@@ -0,0 +1,254 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader carries the W3C trace context between services.
+const TraceparentHeader = "traceparent"
+
+var ErrBadTraceparent = errors.New("malformed traceparent")
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+    TraceID TraceID
+    SpanID SpanID
+    Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+    return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+    flags := "00"
+    if sc.Sampled {
+        flags = "01"
+    }
+    return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent reads a traceparent header value. Versions after 00 are
+// accepted as long as they start with the fields 00 defines.
+func ParseTraceparent(value string) (SpanContext, error) {
+    parts := strings.Split(strings.TrimSpace(value), "-")
+    if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+        return SpanContext{}, ErrBadTraceparent
+    }
+    if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+        return SpanContext{}, ErrBadTraceparent
+    }
+    for _, p := range parts[:4] {
+        if strings.ToLower(p) != p {
+            return SpanContext{}, ErrBadTraceparent
+        }
+    }
+
+    sc := SpanContext{}
+    var flags [1]byte
+    _, err1 := hex.Decode(sc.TraceID[:], []byte(parts[1]))
+    _, err2 := hex.Decode(sc.SpanID[:], []byte(parts[2]))
+    _, err3 := hex.Decode(flags[:], []byte(parts[3]))
+    if err1 != nil || err2 != nil || err3 != nil || !sc.IsValid() {
+        return SpanContext{}, ErrBadTraceparent
+    }
+    sc.Sampled = flags[0] & 1 == 1
+    return sc, nil
+}
+
+// Extract returns the remote parent from an incoming request, if it sent
+// one.
+func Extract(h http.Header) (SpanContext, bool) {
+    sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+    return sc, err == nil
+}
+
+// Inject adds the span in ctx to outgoing request headers.
+func Inject(ctx context.Context, h http.Header) {
+    span := SpanFromContext(ctx)
+    if span == nil {
+        return
+    }
+    h.Set(TraceparentHeader, span.Context().Traceparent())
+}
+
+// SpanKind follows the OTLP numbering.
+type SpanKind int
+
+const (
+    KindInternal SpanKind = 1
+    KindServer SpanKind = 2
+    KindClient SpanKind = 3
+)
+
+// Span is one timed operation. Spans are safe to use from several
+// goroutines, though usually only the one that started it touches it.
+type Span struct {
+    tracer *Tracer
+    sc SpanContext
+    parent SpanID
+
+    mu sync.Mutex
+    name string
+    kind SpanKind
+    start time.Time
+    end time.Time
+    attrs []Attribute
+    err string
+    ended bool
+}
+
+// Attribute values are strings, ints or bools.
+type Attribute struct {
+    Key string
+    Value any
+}
+
+func String(key, value string) Attribute { return Attribute{ key, value } }
+func Int(key string, value int) Attribute { return Attribute{ key, int64(value) } }
+func Bool(key string, value bool) Attribute { return Attribute{ key, value } }
+
+func (s *Span) Context() SpanContext {
+    return s.sc
+}
+
+func (s *Span) SetName(name string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.name = name
+}
+
+func (s *Span) SetAttributes(attrs ...Attribute) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.attrs = append(s.attrs, attrs...)
+}
+
+// SetError marks the span as failed. A nil err does nothing, so it can be
+// called with whatever the traced call returned.
+func (s *Span) SetError(err error) {
+    if err == nil {
+        return
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.err = err.Error()
+}
+
+// End finishes the span and hands it to the exporter if it was sampled.
+// Only the first call counts.
+func (s *Span) End() {
+    s.mu.Lock()
+    if s.ended {
+        s.mu.Unlock()
+        return
+    }
+    s.ended = true
+    s.end = time.Now()
+    s.mu.Unlock()
+
+    if s.sc.Sampled && s.tracer.exporter != nil {
+        s.tracer.exporter.Export(s.snapshot())
+    }
+}
+
+func (s *Span) snapshot() SpanData {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return SpanData {
+        SpanContext: s.sc,
+        Parent: s.parent,
+        Name: s.name,
+        Kind: s.kind,
+        Start: s.start,
+        End: s.end,
+        Attributes: append([]Attribute(nil), s.attrs...),
+        Error: s.err,
+    }
+}
+
+// SpanData is a finished span as exporters see it.
+type SpanData struct {
+    SpanContext
+    Parent SpanID
+    Name string
+    Kind SpanKind
+    Start time.Time
+    End time.Time
+    Attributes []Attribute
+    Error string
+}
+
+// Tracer starts spans and sends the finished ones to its exporter. A tracer
+// without an exporter still propagates trace context, it just records
+// nothing.
+type Tracer struct {
+    exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+    return &Tracer{ exporter: exporter }
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+    return context.WithValue(ctx, spanKey{}, span)
+}
+
+// ContextWithRemoteParent makes the next span started from ctx a child of
+// a span in another service, see Extract.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+    return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFromContext returns the current span or nil.
+func SpanFromContext(ctx context.Context) *Span {
+    span, _ := ctx.Value(spanKey{}).(*Span)
+    return span
+}
+
+// Start begins a span as a child of whatever span is in ctx, or a new trace
+// when there is none. End must be called on the returned span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+    span := &Span {
+        tracer: t,
+        name: name,
+        kind: kind,
+        start: time.Now(),
+        attrs: attrs,
+    }
+
+    if parent := SpanFromContext(ctx); parent != nil {
+        span.sc.TraceID = parent.sc.TraceID
+        span.sc.Sampled = parent.sc.Sampled
+        span.parent = parent.sc.SpanID
+    } else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+        span.sc.TraceID = remote.TraceID
+        span.sc.Sampled = remote.Sampled
+        span.parent = remote.SpanID
+    } else {
+        rand.Read(span.sc.TraceID[:])
+        span.sc.Sampled = true
+    }
+    rand.Read(span.sc.SpanID[:])
+
+    return ContextWithSpan(ctx, span), span
+}
@@ -0,0 +1,210 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trice/Chirpy/internal/tracing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+    tests := []struct {
+        name    string
+        value   string
+        sampled bool
+        wantErr bool
+    }{
+        {
+            name:    "Sampled",
+            value:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+            sampled: true,
+            wantErr: false,
+        },
+        {
+            name:    "Not sampled",
+            value:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+            sampled: false,
+            wantErr: false,
+        },
+        {
+            name:    "Future version with more fields",
+            value:   "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-whatever",
+            sampled: true,
+            wantErr: false,
+        },
+        {
+            name:    "Zero trace id",
+            value:   "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+            wantErr: true,
+        },
+        {
+            name:    "Upper case",
+            value:   "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+            wantErr: true,
+        },
+        {
+            name:    "Invalid version",
+            value:   "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+            wantErr: true,
+        },
+        {
+            name:    "Empty",
+            value:   "",
+            wantErr: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            sc, err := tracing.ParseTraceparent(tt.value)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("ParseTraceparent() error = %v, wantErr %v", err, tt.wantErr)
+            }
+            if tt.wantErr {
+                return
+            }
+            if sc.Sampled != tt.sampled {
+                t.Errorf("Sampled = %v, want %v", sc.Sampled, tt.sampled)
+            }
+            if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+                t.Errorf("TraceID = %s", sc.TraceID)
+            }
+        })
+    }
+}
+
+type recorder struct {
+    mu    sync.Mutex
+    spans []tracing.SpanData
+}
+
+func (r *recorder) Export(span tracing.SpanData) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.spans = append(r.spans, span)
+}
+
+func (r *recorder) Shutdown(ctx context.Context) error {
+    return nil
+}
+
+func TestStartFollowsParent(t *testing.T) {
+    rec := &recorder{}
+    tracer := tracing.NewTracer(rec)
+
+    remote, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+    ctx := tracing.ContextWithRemoteParent(context.Background(), remote)
+
+    ctx, server := tracer.Start(ctx, "GET /api/chirps", tracing.KindServer)
+    _, query := tracer.Start(ctx, "GetChirps", tracing.KindClient)
+    query.SetError(errors.New("boom"))
+    query.End()
+    server.End()
+    server.End()
+
+    if len(rec.spans) != 2 {
+        t.Fatalf("exported %d spans, want 2", len(rec.spans))
+    }
+    q, s := rec.spans[0], rec.spans[1]
+    if s.TraceID != remote.TraceID || s.Parent != remote.SpanID {
+        t.Errorf("server span is not a child of the remote parent")
+    }
+    if q.TraceID != s.TraceID || q.Parent != s.SpanID {
+        t.Errorf("query span is not a child of the server span")
+    }
+    if q.Error != "boom" {
+        t.Errorf("query span error = %q", q.Error)
+    }
+
+    h := http.Header{}
+    tracing.Inject(ctx, h)
+    if h.Get(tracing.TraceparentHeader) != server.Context().Traceparent() {
+        t.Errorf("Inject() = %q", h.Get(tracing.TraceparentHeader))
+    }
+}
+
+func TestUnsampledParentIsNotExported(t *testing.T) {
+    rec := &recorder{}
+    tracer := tracing.NewTracer(rec)
+
+    remote, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+    _, span := tracer.Start(tracing.ContextWithRemoteParent(context.Background(), remote), "work", tracing.KindInternal)
+    span.End()
+
+    if len(rec.spans) != 0 {
+        t.Errorf("exported %d spans, want none", len(rec.spans))
+    }
+}
+
+func TestWriterExporter(t *testing.T) {
+    out := bytes.Buffer{}
+    tracer := tracing.NewTracer(&tracing.WriterExporter{ Out: &out, Service: "chirpy" })
+
+    _, span := tracer.Start(context.Background(), "login", tracing.KindServer, tracing.Int("http.response.status_code", 200))
+    span.End()
+
+    var body struct {
+        ResourceSpans []struct {
+            ScopeSpans []struct {
+                Spans []struct {
+                    TraceID    string `json:"traceId"`
+                    Name       string `json:"name"`
+                    Attributes []struct {
+                        Key   string            `json:"key"`
+                        Value map[string]string `json:"value"`
+                    } `json:"attributes"`
+                } `json:"spans"`
+            } `json:"scopeSpans"`
+        } `json:"resourceSpans"`
+    }
+    err := json.Unmarshal(out.Bytes(), &body)
+    if err != nil {
+        t.Fatalf("output is not JSON: %v", err)
+    }
+    got := body.ResourceSpans[0].ScopeSpans[0].Spans[0]
+    if got.Name != "login" || got.TraceID != span.Context().TraceID.String() {
+        t.Errorf("exported span = %+v", got)
+    }
+    if got.Attributes[0].Value["intValue"] != "200" {
+        t.Errorf("attribute = %+v", got.Attributes[0])
+    }
+}
+
+func TestOTLPExporterFlushesOnShutdown(t *testing.T) {
+    var mu sync.Mutex
+    bodies := []string{}
+    collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        d, _ := io.ReadAll(r.Body)
+        mu.Lock()
+        bodies = append(bodies, string(d))
+        mu.Unlock()
+    }))
+    defer collector.Close()
+
+    exporter := tracing.NewOTLPExporter(collector.URL + "/v1/traces", "chirpy")
+    tracer := tracing.NewTracer(exporter)
+    _, span := tracer.Start(context.Background(), "GetChirps", tracing.KindClient)
+    span.End()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+    defer cancel()
+    err := exporter.Shutdown(ctx)
+    if err != nil {
+        t.Fatalf("Shutdown() error = %v", err)
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    if len(bodies) != 1 || !strings.Contains(bodies[0], `"name":"GetChirps"`) {
+        t.Errorf("collector got %q", bodies)
+    }
+}
@@ -0,0 +1,81 @@
+package webhook_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trice/Chirpy/internal/webhook"
+)
+
+func TestVerify(t *testing.T) {
+    secret := []byte("f271c81ff7084ee5b99a5091b42d486e")
+    body := []byte(`{"event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+    sent := time.Unix(1700000000, 0)
+
+    tests := []struct {
+        name        string
+        header      string
+        body        []byte
+        now         time.Time
+        expectError error
+    }{
+        {
+            name:   "Valid",
+            header: webhook.Sign(secret, body, sent),
+            body:   body,
+            now:    sent.Add(time.Minute),
+        },
+        {
+            name:   "Rotated secret",
+            header: webhook.Sign([]byte("old"), body, sent) + "," + strings.Split(webhook.Sign(secret, body, sent), ",")[1],
+            body:   body,
+            now:    sent,
+        },
+        {
+            name:        "Missing",
+            header:      "",
+            body:        body,
+            now:         sent,
+            expectError: webhook.ErrNoSignature,
+        },
+        {
+            name:        "Tampered body",
+            header:      webhook.Sign(secret, body, sent),
+            body:        []byte(`{"event":"user.upgraded","data":{"user_id":"someone-else"}}`),
+            now:         sent,
+            expectError: webhook.ErrBadSignature,
+        },
+        {
+            name:        "Wrong secret",
+            header:      webhook.Sign([]byte("wrong"), body, sent),
+            body:        body,
+            now:         sent,
+            expectError: webhook.ErrBadSignature,
+        },
+        {
+            name:        "Replayed later",
+            header:      webhook.Sign(secret, body, sent),
+            body:        body,
+            now:         sent.Add(time.Hour),
+            expectError: webhook.ErrStaleSignature,
+        },
+        {
+            name:        "Garbage",
+            header:      "v1=zz,t=soon",
+            body:        body,
+            now:         sent,
+            expectError: webhook.ErrBadSignature,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := webhook.Verify(secret, tt.header, tt.body, tt.now, 5 * time.Minute)
+            if !errors.Is(err, tt.expectError) {
+                t.Errorf("Verify() error = %v, want %v", err, tt.expectError)
+            }
+        })
+    }
+}
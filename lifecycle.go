@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/trice/Chirpy/internal/config"
+	"github.com/trice/Chirpy/internal/health"
+	"github.com/trice/Chirpy/internal/migrate"
+	"github.com/trice/Chirpy/sql/schema"
+)
+
+// backgroundJobs runs the periodic jobs like subscription expiry so they
+// can all be stopped, and waited for, on shutdown.
+type backgroundJobs struct {
+    wg sync.WaitGroup
+    cancels []context.CancelFunc
+}
+
+// start runs job in its own goroutine until ctx is done or stop is called.
+func (b *backgroundJobs) start(ctx context.Context, job func(ctx context.Context)) {
+    ctx, cancel := context.WithCancel(ctx)
+    b.cancels = append(b.cancels, cancel)
+    b.wg.Add(1)
+    go func() {
+        defer b.wg.Done()
+        job(ctx)
+    }()
+}
+
+func (b *backgroundJobs) stop() {
+    for _, cancel := range b.cancels {
+        cancel()
+    }
+    b.wg.Wait()
+}
+
+// openDB connects to the database. sql.Open doesn't connect, so it pings
+// to find out about a bad DB_URL now rather than on the first request.
+func openDB(ctx context.Context, conf config.Config) (*sql.DB, error) {
+    if len(conf.DatabaseURL) == 0 {
+        return nil, errors.New("database.url ($DB_URL) is required")
+    }
+    db, err := sql.Open("postgres", conf.DatabaseURL)
+    if err != nil {
+        return nil, fmt.Errorf("opening database: %w", err)
+    }
+
+    pingCtx, cancel := context.WithTimeout(ctx, 10 * time.Second)
+    defer cancel()
+    err = db.PingContext(pingCtx)
+    if err != nil {
+        db.Close()
+        return nil, fmt.Errorf("connecting to database: %w", err)
+    }
+    return db, nil
+}
+
+func newMigrator(db *sql.DB) (*migrate.Migrator, error) {
+    migrations, err := migrate.Load(schema.FS)
+    if err != nil {
+        return nil, fmt.Errorf("loading migrations: %w", err)
+    }
+    return &migrate.Migrator{ DB: db, Migrations: migrations }, nil
+}
+
+// serve runs server until it fails or ctx is done. It then fails readiness
+// probes for delay, so load balancers notice before the listener goes away,
+// and gives in flight requests up to timeout to finish.
+func serve(ctx context.Context, server *http.Server, readiness *health.Checker, delay, timeout time.Duration) error {
+    serveErr := make(chan error, 1)
+    go func() {
+        slog.Info("listening", "addr", server.Addr)
+        serveErr <- server.ListenAndServe()
+    }()
+
+    select {
+    case err := <-serveErr:
+        // most likely the port is taken
+        return fmt.Errorf("serving: %w", err)
+    case <-ctx.Done():
+    }
+
+    readiness.ShutDown()
+    slog.Info("shutting down", "delay", delay, "timeout", timeout)
+    time.Sleep(delay)
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    err := server.Shutdown(shutdownCtx)
+    if err != nil {
+        return fmt.Errorf("draining requests: %w", err)
+    }
+
+    err = <-serveErr
+    if !errors.Is(err, http.ErrServerClosed) {
+        return err
+    }
+    slog.Info("stopped")
+    return nil
+}
@@ -1,35 +1,72 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
-	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/config"
 	"github.com/trice/Chirpy/internal/database"
+	"github.com/trice/Chirpy/internal/dbstats"
+	"github.com/trice/Chirpy/internal/entitlements"
+	"github.com/trice/Chirpy/internal/logging"
+	"github.com/trice/Chirpy/internal/mail"
+	"github.com/trice/Chirpy/internal/migrate"
+	"github.com/trice/Chirpy/internal/oidc"
+	"github.com/trice/Chirpy/internal/ratelimit"
+	"github.com/trice/Chirpy/internal/tracing"
+	"github.com/trice/Chirpy/internal/webhook"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
+	metrics *serverMetrics
+    db *sql.DB
+    dbStats *dbstats.DB
+    migrator *migrate.Migrator
     queries *database.Queries
     platform string
+    devFixtures string
     tokenSecret string
     polkaKey string
+    adminKey string
+    mailer mail.Sender
+    oidcProviders map[string]*oidc.Provider
+    rateLimiter ratelimit.Store
+    rateLimits map[string]ratelimit.Limit
+    trustProxy bool
+    accessTokenTTL time.Duration
+    refreshTokenTTL time.Duration
+    deletionGrace time.Duration
+    exportTTL time.Duration
+    plans entitlements.Plans
+    tracer *tracing.Tracer
+}
+
+// queriesTx is cfg.queries.WithTx, except the transaction's queries are
+// timed and traced like all the others
+func (cfg *apiConfig) queriesTx(tx *sql.Tx) *database.Queries {
+    return database.New(cfg.dbStats.Wrap(tx))
 }
 
 func (cfg *apiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        cfg.fileserverHits.Add(1)
+        cfg.metrics.fileserverHits.Inc()
         next.ServeHTTP(w, r)
     })
 }
@@ -43,7 +80,7 @@ func (cfg * apiConfig) GetHits(writer http.ResponseWriter, request *http.Request
                     </html>`
     writer.Header().Set("Content-Type", "text/html; charset=utf-8") // normal header
     writer.WriteHeader(http.StatusOK)
-    hits := cfg.fileserverHits.Load()
+    hits := int(cfg.metrics.fileserverHits.Value())
     message := fmt.Sprintf(htmlFormat, hits)
     writer.Write([]byte(message))
 }
@@ -98,6 +135,37 @@ func (cfg * apiConfig) createUser(writer http.ResponseWriter, request *http.Requ
     writer.Write(d)
 }
 
+// reauthTokenTTL is how long after signing in an account without a password
+// can still change its email, password or 2FA, or delete itself
+const reauthTokenTTL = 5 * time.Minute
+
+// requireReauth asks for more than the access token before the account
+// itself is changed, so a stolen token isn't enough to take it over.
+// Accounts with a password confirm it. Accounts that only sign in through an
+// identity provider show the reauth_token of a sign in from the last few
+// minutes instead. It writes the 403 itself and returns false.
+func (cfg *apiConfig) requireReauth(w http.ResponseWriter, r *http.Request, userRow database.User, currentPassword, reauthToken string) bool {
+    if len(userRow.HashedPassword) != 0 {
+        err := cfg.checkPassword(r.Context(), currentPassword, userRow.HashedPassword)
+        if err != nil {
+            w.Header().Set("Content-Type", "application/json; charset=utf-8")
+            w.WriteHeader(http.StatusForbidden)
+            w.Write([]byte(`{"error":"current password is incorrect"}`))
+            return false
+        }
+        return true
+    }
+
+    userID, err := auth.ValidateReauthToken(reauthToken, cfg.tokenSecret)
+    if err != nil || userID != userRow.ID {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusForbidden)
+        w.Write([]byte(`{"error":"sign in again to confirm it's you"}`))
+        return false
+    }
+    return true
+}
+
 func (cfg * apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
     validUuid := validateAccessToken(r, w, cfg)
     if validUuid == (uuid.UUID{}) {
@@ -106,9 +174,12 @@ func (cfg * apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    // every field is optional, only the ones present in the body are changed
     type body struct {
-        Password string `json:"password"`
-        Email string `json:"email"`
+        Password *string `json:"password"`
+        Email *string `json:"email"`
+        CurrentPassword string `json:"current_password"`
+        ReauthToken string `json:"reauth_token"`
     }
     data, err := io.ReadAll(r.Body)
     if err != nil {
@@ -127,22 +198,68 @@ func (cfg * apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    hashPass, err := auth.HashPassword(rb.Password)
+    userRow, err := cfg.queries.GetUserById(r.Context(), validUuid)
     if err != nil {
-        w.Header().Set("Content-Type", "application/json; charset=utf-8")
-        w.WriteHeader(http.StatusBadRequest)
-        w.Write([]byte(`{"error":"something went wrong"}`))
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    if (rb.Email != nil || rb.Password != nil) && !cfg.requireReauth(w, r, userRow, rb.CurrentPassword, rb.ReauthToken) {
         return
     }
 
     updateParams := database.UpdateUserParams {
-        Email: rb.Email,
-        HashedPassword: hashPass,
-        ID: uuid.NullUUID{ UUID: validUuid, Valid: true, },
+        Email: userRow.Email,
+        HashedPassword: userRow.HashedPassword,
+        ID: userRow.ID,
+    }
+
+    if rb.Email != nil {
+        if len(*rb.Email) == 0 {
+            w.Header().Set("Content-Type", "application/json; charset=utf-8")
+            w.WriteHeader(http.StatusBadRequest)
+            w.Write([]byte(`{"error":"email can not be empty"}`))
+            return
+        }
+        updateParams.Email = *rb.Email
     }
+
+    if rb.Password != nil {
+        if len(*rb.Password) == 0 {
+            w.Header().Set("Content-Type", "application/json; charset=utf-8")
+            w.WriteHeader(http.StatusBadRequest)
+            w.Write([]byte(`{"error":"password can not be empty"}`))
+            return
+        }
+        hashPass, err := auth.HashPassword(*rb.Password)
+        if err != nil {
+            w.Header().Set("Content-Type", "application/json; charset=utf-8")
+            w.WriteHeader(http.StatusBadRequest)
+            w.Write([]byte(`{"error":"something went wrong"}`))
+            return
+        }
+        updateParams.HashedPassword = hashPass
+    }
+
     updateUser, err := cfg.queries.UpdateUser(r.Context(), updateParams)
     if err != nil {
+        var pqErr *pq.Error
+        if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+            w.Header().Set("Content-Type", "application/json; charset=utf-8")
+            w.WriteHeader(http.StatusConflict)
+            w.Write([]byte(`{"error":"email already in use"}`))
+            return
+        }
+        logging.FromContext(r.Context()).Error("updating user failed", "err", err)
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
 
+    if updateUser.Email != userRow.Email {
+        cfg.notifyEmailChanged(r.Context(), userRow.Email, updateUser.Email)
     }
 
     d, _ := json.Marshal(updateUser)
@@ -151,14 +268,20 @@ func (cfg * apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
     w.Write(d)
 }
 
-func (cfg * apiConfig) resetHits(writer http.ResponseWriter, request *http.Request) {
-    cfg.fileserverHits.Store(0)
-    if cfg.platform == "dev" {
-        cfg.queries.DeleteUser(request.Context())
-    } else {
-        writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
-        writer.WriteHeader(http.StatusForbidden)
-    }
+// let the previous address know, in case the change was not made by the owner
+func (cfg *apiConfig) notifyEmailChanged(ctx context.Context, oldEmail, newEmail string) {
+    subject := "Your Chirpy email address was changed"
+    message := fmt.Sprintf("The email address on your Chirpy account was changed to %s.\n" +
+        "If you did not make this change please contact support right away.", newEmail)
+    // the request is long gone by the time the mail goes out, keep only its
+    // logger
+    logger := logging.FromContext(ctx)
+    go func() {
+        err := cfg.mailer.Send(context.Background(), oldEmail, subject, message)
+        if err != nil {
+            logger.Error("email change notification failed", "err", err)
+        }
+    }()
 }
 
 func (cfg * apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
@@ -166,14 +289,20 @@ func (cfg * apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
     type body struct {
         Body string `json:"body"`
         UserId uuid.UUID `json:"user_id"`
+        PublishAt *time.Time `json:"publish_at"`
     }
 
-    validUuid := validateAccessToken(r, w, cfg)
+    validUuid, scoped := validateScopedAccessToken(r, w, cfg, auth.ScopeChirpsWrite)
     if validUuid == (uuid.UUID{}) {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusUnauthorized)
         return
     }
+    if !scoped {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusForbidden)
+        return
+    }
 
     data, err := io.ReadAll(r.Body)
     if err != nil {
@@ -192,18 +321,65 @@ func (cfg * apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    userRow, err := cfg.requestUser(r)
+    if err != nil {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+    perks := cfg.plans.For(userRow.IsChirpyRed)
+
+    within := database.CountChirpsByUserWithinParams {
+        UserID: validUuid,
+        WindowSecs: time.Hour.Seconds(),
+    }
+    recent, err := cfg.queries.CountChirpsByUserWithin(r.Context(), within)
+    if err != nil {
+        logging.FromContext(r.Context()).Error("counting recent chirps failed", "err", err)
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+    if recent >= int64(perks.ChirpsPerHour) {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusTooManyRequests)
+        w.Write([]byte(`{"error": "Too many chirps, try again later"}`))
+        return
+    }
+
     rb.Body = scrubMessage(rb.Body)
 
-    if len(rb.Body) > 140 {
+    if len(rb.Body) > perks.MaxChirpLength {
         w.Header().Set("Content-Type", "application/json; charset=utf-8")
         w.WriteHeader(http.StatusBadRequest)
         w.Write([]byte(`{"error": "Chirp is too long"}`))
         return
     }
 
+    // anything not in the future is published right away
+    publishAt := sql.NullTime{}
+    now := time.Now()
+    if rb.PublishAt != nil && rb.PublishAt.After(now) {
+        if !perks.CanScheduleChirps {
+            w.Header().Set("Content-Type", "application/json; charset=utf-8")
+            w.WriteHeader(http.StatusForbidden)
+            w.Write([]byte(`{"error": "Scheduling chirps needs Chirpy Red"}`))
+            return
+        }
+        if rb.PublishAt.After(now.Add(perks.MaxScheduleAhead)) {
+            w.Header().Set("Content-Type", "application/json; charset=utf-8")
+            w.WriteHeader(http.StatusBadRequest)
+            w.Write([]byte(`{"error": "Chirp is scheduled too far ahead"}`))
+            return
+        }
+        publishAt = sql.NullTime{ Time: *rb.PublishAt, Valid: true }
+    }
+
     newChirp := database.CreateChirpParams {
         Body: rb.Body,
         UserID: validUuid,
+        PublishAt: publishAt,
     }
 
     dbResult, err := cfg.queries.CreateChirp(r.Context(), newChirp)
@@ -213,6 +389,7 @@ func (cfg * apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
         w.Write([]byte(`{"error":"something went wrong"}`))
         return
     }
+    cfg.metrics.chirpsCreated.Inc()
 
     d, _ := json.Marshal(dbResult)
     w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -221,18 +398,142 @@ func (cfg * apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
 }
 
 // check of the Access Token is valide and if so return the UUID of the user.
+// Personal API keys and third party tokens are turned down, routes that take
+// them use validateScopedAccessToken and name the scope they need.
 func validateAccessToken(r *http.Request, w http.ResponseWriter, cfg *apiConfig) (uuid.UUID) {
-	jwt, err := auth.GetBearerToken(r.Header)
-	if err != nil {
+	p, err := authenticateRequest(r, cfg)
+	if err != nil || p.scopes != nil {
 		return uuid.UUID{}
 	}
 
-	validUuid, err := auth.ValidateJWT(jwt, cfg.tokenSecret)
+	return p.userID
+}
+
+// check the Access Token like validateAccessToken, but also accept tokens
+// issued to third party clients and scoped API keys. The bool is false when
+// the token is fine but wasn't granted scope.
+func validateScopedAccessToken(r *http.Request, w http.ResponseWriter, cfg *apiConfig, scope string) (uuid.UUID, bool) {
+	p, err := authenticateRequest(r, cfg)
 	if err != nil {
-		return uuid.UUID{}
+		return uuid.UUID{}, false
+	}
+
+	if !auth.HasScope(p.scopes, scope) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="` + scope + `"`)
+		return p.userID, false
+	}
+
+	return p.userID, true
+}
+
+// principal is who made a request and what they may do
+type principal struct {
+	userID uuid.UUID
+	// nil means everything, a first party token
+	scopes []string
+	// the user row, once something has read it
+	user *database.User
+}
+
+// requestAuth remembers the answer of authenticateRequest for the rest of
+// the request, so the rate limiter and the handler don't both look up the
+// token. Only requests that went through withRequestAuth have one.
+type requestAuth struct {
+	done bool
+	p principal
+	err error
+}
+
+type requestAuthKey struct{}
+
+func withRequestAuth(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(requestAuthKey{}).(*requestAuth); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestAuthKey{}, &requestAuth{}))
+}
+
+// authenticateRequest looks at the bearer token and returns who it belongs
+// to and what it may do. Tokens of disabled or deleted users are turned
+// down here, for every endpoint at once.
+func authenticateRequest(r *http.Request, cfg *apiConfig) (principal, error) {
+	ra, ok := r.Context().Value(requestAuthKey{}).(*requestAuth)
+	if !ok {
+		return authenticateToken(r, cfg)
+	}
+	if !ra.done {
+		ra.p, ra.err = authenticateToken(r, cfg)
+		ra.done = true
+	}
+	return ra.p, ra.err
+}
+
+// requestUser returns the user row of whoever made the request, read once
+// per request like authenticateRequest
+func (cfg *apiConfig) requestUser(r *http.Request) (database.User, error) {
+	p, err := authenticateRequest(r, cfg)
+	if err != nil {
+		return database.User{}, err
+	}
+	if p.user != nil {
+		return *p.user, nil
+	}
+
+	userRow, err := cfg.queries.GetUserById(r.Context(), p.userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	if ra, ok := r.Context().Value(requestAuthKey{}).(*requestAuth); ok {
+		ra.p.user = &userRow
+	}
+	return userRow, nil
+}
+
+var errAccountInactive = errors.New("account is disabled or deleted")
+
+// activeUser loads the user a token is about to be accepted or minted for
+// and turns it away once the account is disabled or deleted
+func (cfg *apiConfig) activeUser(ctx context.Context, userID uuid.UUID) (database.User, error) {
+	userRow, err := cfg.queries.GetUserById(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	if userRow.DisabledAt.Valid || userRow.DeletedAt.Valid {
+		return database.User{}, errAccountInactive
+	}
+	return userRow, nil
+}
+
+func authenticateToken(r *http.Request, cfg *apiConfig) (principal, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return principal{}, err
+	}
+
+	if !auth.IsAPIKey(token) {
+		userID, scopes, err := auth.ValidateScopedJWT(token, cfg.tokenSecret)
+		if err != nil {
+			return principal{}, err
+		}
+		// access tokens live on after the account is switched off, so
+		// look at it every time
+		userRow, err := cfg.activeUser(r.Context(), userID)
+		if err != nil {
+			return principal{}, err
+		}
+		logging.SetUserID(r.Context(), userID.String())
+		return principal{ userID: userID, scopes: scopes, user: &userRow }, nil
+	}
+
+	// only finds keys of active users
+	key, err := cfg.queries.GetAPIKeyByHash(r.Context(), auth.HashToken(token))
+	if err != nil {
+		return principal{}, err
 	}
+	cfg.queries.TouchAPIKey(r.Context(), key.ID)
+	logging.SetUserID(r.Context(), key.UserID.String())
 
-	return validUuid
+	return principal{ userID: key.UserID, scopes: strings.Fields(key.Scope) }, nil
 }
 
 func (cfg *apiConfig) getChirps(w http.ResponseWriter, r *http.Request)  {
@@ -242,7 +543,11 @@ func (cfg *apiConfig) getChirps(w http.ResponseWriter, r *http.Request)  {
     var chirpAscByCreate []database.Chirp
     var err error
     if len(author) != 0 {
-        authorId := uuid.MustParse(author)
+        authorId, parseErr := uuid.Parse(author)
+        if parseErr != nil {
+            http.Error(w, "author_id is not a valid id", http.StatusBadRequest)
+            return
+        }
         chirpAscByCreate, err = cfg.queries.GetChirpsByAuthor(r.Context(), authorId)
     } else {
         chirpAscByCreate, err = cfg.queries.GetChirps(r.Context())
@@ -250,47 +555,86 @@ func (cfg *apiConfig) getChirps(w http.ResponseWriter, r *http.Request)  {
 
     if err != nil {
         http.Error(w, "Error reading chirps", http.StatusNotFound)
+        return
     }
 
     if sortOrder == "desc" {
         sort.Slice(chirpAscByCreate, func(i, j int) bool {
-            return chirpAscByCreate[i].CreatedAt.After(chirpAscByCreate[j].CreatedAt)
+            return chirpAscByCreate[i].PublishAt.After(chirpAscByCreate[j].PublishAt)
         })
     }
 
-    d, _ := json.Marshal(chirpAscByCreate)
+    var d []byte
+    if wantsAuthor(r) {
+        withAuthors, err := cfg.embedAuthors(r.Context(), chirpAscByCreate)
+        if err != nil {
+            http.Error(w, "Error reading chirps", http.StatusInternalServerError)
+            return
+        }
+        d, _ = json.Marshal(withAuthors)
+    } else {
+        d, _ = json.Marshal(chirpAscByCreate)
+    }
     w.Header().Set("Content-Type", "application/json; charset=utf-8")
     w.WriteHeader(http.StatusOK)
     w.Write(d)
 }
 
 func (cfg* apiConfig) getChirpBy(w http.ResponseWriter, r *http.Request)  {
-    var chirpId uuid.NullUUID
-    chirpId.UUID = uuid.MustParse(r.PathValue("chirpID"))
-    chirpId.Valid = true
-    chirpResult, err := cfg.queries.GetChirpById(r.Context(), chirpId)
+    chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        http.Error(w, "chirp not found", http.StatusNotFound)
+        return
+    }
+    chirpResult, err := cfg.queries.GetPublishedChirpById(r.Context(), chirpId)
+    // scheduled chirps don't exist for anyone but their author until they
+    // go out
+    if errors.Is(err, sql.ErrNoRows) {
+        p, authErr := authenticateRequest(r, cfg)
+        if authErr == nil {
+            chirpResult, err = cfg.queries.GetChirpById(r.Context(), chirpId)
+            if err == nil && chirpResult.UserID != p.userID {
+                err = sql.ErrNoRows
+            }
+        }
+    }
     if err != nil {
         http.Error(w, "chirp not found", http.StatusNotFound)
         return
     }
 
     d, _ := json.Marshal(chirpResult)
+    if wantsAuthor(r) {
+        withAuthor, err := cfg.embedAuthors(r.Context(), []database.Chirp{ chirpResult })
+        if err != nil {
+            http.Error(w, "Error reading chirp", http.StatusInternalServerError)
+            return
+        }
+        d, _ = json.Marshal(withAuthor[0])
+    }
     w.Header().Set("Content-Type", "application/json; charset=utf-8")
     w.WriteHeader(http.StatusOK)
     w.Write(d)
 }
 
 func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
-    validUuid := validateAccessToken(r, w, cfg)
+    validUuid, scoped := validateScopedAccessToken(r, w, cfg, auth.ScopeChirpsWrite)
     if validUuid == (uuid.UUID{}) {
         w.Header().Set("Content-Type", "text/plain; charset=utf-8")
         w.WriteHeader(http.StatusUnauthorized)
         return
     }
+    if !scoped {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusForbidden)
+        return
+    }
 
-    var chirpId uuid.NullUUID
-    chirpId.UUID = uuid.MustParse(r.PathValue("chirpID"))
-    chirpId.Valid = true
+    chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        http.Error(w, "chirp not found", http.StatusNotFound)
+        return
+    }
     chirpResult, err := cfg.queries.GetChirpById(r.Context(), chirpId)
     if err != nil {
         http.Error(w, "chirp not found", http.StatusNotFound)
@@ -311,18 +655,101 @@ func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
     w.WriteHeader(http.StatusNoContent)
 }
 
+// editChirp changes the body of one of the user's chirps, a Chirpy Red perk
+func (cfg *apiConfig) editChirp(w http.ResponseWriter, r *http.Request) {
+    validUuid, scoped := validateScopedAccessToken(r, w, cfg, auth.ScopeChirpsWrite)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+    if !scoped {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusForbidden)
+        return
+    }
+
+    type body struct {
+        Body string `json:"body"`
+    }
+    data, err := io.ReadAll(r.Body)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    rb := body{}
+    err = json.Unmarshal(data, &rb)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    userRow, err := cfg.requestUser(r)
+    if err != nil {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+    perks := cfg.plans.For(userRow.IsChirpyRed)
+    if !perks.CanEditChirps {
+        http.Error(w, "editing chirps needs Chirpy Red", http.StatusForbidden)
+        return
+    }
+
+    chirpId, err := uuid.Parse(r.PathValue("chirpID"))
+    if err != nil {
+        http.Error(w, "chirp not found", http.StatusNotFound)
+        return
+    }
+
+    chirpResult, err := cfg.queries.GetChirpById(r.Context(), chirpId)
+    if err != nil {
+        http.Error(w, "chirp not found", http.StatusNotFound)
+        return
+    }
+
+    if chirpResult.UserID != validUuid {
+        http.Error(w, "that is not yours", http.StatusForbidden)
+        return
+    }
+
+    rb.Body = scrubMessage(rb.Body)
+
+    if len(rb.Body) > perks.MaxChirpLength {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error": "Chirp is too long"}`))
+        return
+    }
+
+    updateParams := database.UpdateChirpForUserParams {
+        ID: chirpId,
+        UserID: validUuid,
+        Body: rb.Body,
+    }
+    updated, err := cfg.queries.UpdateChirpForUser(r.Context(), updateParams)
+    if err != nil {
+        http.Error(w, "chirp not found", http.StatusNotFound)
+        return
+    }
+
+    d, _ := json.Marshal(updated)
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    w.Write(d)
+}
+
 func (cfg* apiConfig) login(w http.ResponseWriter, r *http.Request)  {
     type body struct {
         Password string `json:"password"`
         Email string `json:"email"`
     }
 
-    type userReturn struct {
-        database.User
-        Token string `json:"token"`
-        RefreshToken string `json:"refresh_token"`
-    }
-
     data, err := io.ReadAll(r.Body)
     if err != nil {
         w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -341,40 +768,120 @@ func (cfg* apiConfig) login(w http.ResponseWriter, r *http.Request)  {
     }
 
     userRow, err := cfg.queries.GetUser(r.Context(), rb.Email)
-    err = auth.CheckPasswordHash(rb.Password, userRow.HashedPassword)
+    err = cfg.checkPassword(r.Context(), rb.Password, userRow.HashedPassword)
     if err != nil {
         w.Header().Set("Content-Type", "text/plain; charset=utf-8")
         w.WriteHeader(http.StatusUnauthorized)
         return
     }
 
-    tok, err := auth.MakeJWT(userRow.ID.UUID, cfg.tokenSecret, time.Duration(3600) * time.Second)
+    cfg.finishLogin(w, r, userRow)
+}
+
+// finishLogin is called once the first factor checked out. With 2FA turned on
+// that only buys a challenge token, the real tokens are handed out by loginMFA
+// once the second factor checks out too.
+func (cfg *apiConfig) finishLogin(w http.ResponseWriter, r *http.Request, userRow database.User) {
+    totp, err := cfg.queries.GetTOTPForUser(r.Context(), userRow.ID)
+    if err == nil && totp.ConfirmedAt.Valid {
+        mfaTok, err := auth.MakeMFAToken(userRow.ID, cfg.tokenSecret, 5 * time.Minute)
+        if err != nil {
+            w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+
+        type challenge struct {
+            MFARequired bool `json:"mfa_required"`
+            MFAToken string `json:"mfa_token"`
+        }
+        d, _ := json.Marshal(challenge{ true, mfaTok })
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusOK)
+        w.Write(d)
+        return
+    }
+
+    cfg.issueSession(w, r, userRow)
+}
+
+// create the access and refresh tokens for a fully authenticated user and
+// write them out along with the user
+func (cfg *apiConfig) issueSession(w http.ResponseWriter, r *http.Request, userRow database.User) {
+    // spelled out rather than embedding the row, so the password hash and
+    // the admin columns stay out of the response
+    type userReturn struct {
+        ID uuid.UUID `json:"id"`
+        CreatedAt time.Time `json:"created_at"`
+        UpdatedAt time.Time `json:"updated_at"`
+        Email string `json:"email"`
+        IsChirpyRed bool `json:"is_chirpy_red"`
+        Username string `json:"username,omitempty"`
+        Token string `json:"token"`
+        RefreshToken string `json:"refresh_token"`
+        ReauthToken string `json:"reauth_token,omitempty"`
+    }
+
+    // password, MFA and identity provider logins end up here. Tokens are
+    // checked again on every request in authenticateToken, and refreshToken
+    // and oauthToken look the user up before minting new ones.
+    if userRow.DeletedAt.Valid {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+    if userRow.DisabledAt.Valid {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusForbidden)
+        w.Write([]byte(`{"error":"account disabled"}`))
+        return
+    }
+
+    tok, err := auth.MakeJWT(userRow.ID, cfg.tokenSecret, cfg.accessTokenTTL)
     if err != nil {
         w.Header().Set("Content-Type", "text/plain; charset=utf-8")
         w.WriteHeader(http.StatusUnauthorized)
         return
     }
 
+    // accounts without a password have nothing else to show requireReauth
+    reauthTok := ""
+    if len(userRow.HashedPassword) == 0 {
+        reauthTok, err = auth.MakeReauthToken(userRow.ID, cfg.tokenSecret, reauthTokenTTL)
+        if err != nil {
+            w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+    }
+
     // ignoring error, it seems very rare that an error is possible
     refTok, _ := auth.MakeRefreshToken()
     nullTime := sql.NullTime {
-            Time: time.Now().Add(60*(24*time.Hour)),
+            Time: time.Now().Add(cfg.refreshTokenTTL),
             Valid: true,
     }
 
     refTokDbParam := database.CreateRefreshTokenParams {
         Token: refTok,
-        UserID: userRow.ID.UUID,
+        UserID: userRow.ID,
         ExpiresAt: nullTime.Time,
     }
 
     // store the refresh token in the database
     cfg.queries.CreateRefreshToken(r.Context(), refTokDbParam)
+    logging.SetUserID(r.Context(), userRow.ID.String())
 
     user := userReturn {
-        userRow,
-        tok,
-        refTok,
+        ID: userRow.ID,
+        CreatedAt: userRow.CreatedAt,
+        UpdatedAt: userRow.UpdatedAt,
+        Email: userRow.Email,
+        IsChirpyRed: userRow.IsChirpyRed,
+        Username: userRow.Username.String,
+        Token: tok,
+        RefreshToken: refTok,
+        ReauthToken: reauthTok,
     }
 
     d, _ := json.Marshal(user)
@@ -393,7 +900,16 @@ func (cfg *apiConfig) refreshToken(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    authToken, err := auth.MakeJWT(refreshTokenRow.UserID, cfg.tokenSecret, time.Duration(3600)*time.Second)
+    // switching an account off revokes its refresh tokens, but don't rely
+    // on that alone
+    _, err = cfg.activeUser(r.Context(), refreshTokenRow.UserID)
+    if err != nil {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    authToken, err := auth.MakeJWT(refreshTokenRow.UserID, cfg.tokenSecret, cfg.accessTokenTTL)
     if err != nil {
         w.Header().Set("Content-Type", "text/plain; charset=utf-8")
         w.WriteHeader(http.StatusUnauthorized)
@@ -412,21 +928,13 @@ func (cfg *apiConfig) refreshToken(w http.ResponseWriter, r *http.Request) {
     w.Write(d)
 }
 
+// chirpyRedPayment receives Polka webhooks. Deliveries are signed with the
+// Polka key, recorded in webhook_events and only applied once per event ID,
+// since Polka redelivers anything it didn't see a 2xx for.
 func (cfg *apiConfig) chirpyRedPayment(w http.ResponseWriter, r *http.Request) {
-    type data struct {
-        UserId uuid.UUID `json:"user_id"`
-    }
-
     type body struct {
+        ID string `json:"id"`
         Event string `json:"event"`
-        Data data `json:"data"`
-    }
-
-    polkaKey, err := auth.GetBearerToken(r.Header)
-    if err != nil || polkaKey != cfg.polkaKey {
-        w.Header().Set("Content-Type", "application/json; charset=utf-8")
-        w.WriteHeader(http.StatusUnauthorized)
-        return
     }
 
     bodyData, err := io.ReadAll(r.Body)
@@ -437,6 +945,13 @@ func (cfg *apiConfig) chirpyRedPayment(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    err = webhook.Verify([]byte(cfg.polkaKey), r.Header.Get(webhook.SignatureHeader), bodyData, time.Now(), 5 * time.Minute)
+    if err != nil || len(cfg.polkaKey) == 0 {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
     rb := body{}
     err = json.Unmarshal(bodyData, &rb)
     if err != nil {
@@ -446,28 +961,95 @@ func (cfg *apiConfig) chirpyRedPayment(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    if rb.Event != "user.upgraded" {
+    // the id is what tells a redelivery apart from a new event with the
+    // same payload, like a second upgrade after a downgrade
+    eventID := rb.ID
+    if len(eventID) == 0 {
         w.Header().Set("Content-Type", "application/json; charset=utf-8")
-        w.WriteHeader(http.StatusNoContent)
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"event id is required"}`))
         return
     }
 
-    param := database.UpdateRedParams {
-        ID: uuid.NullUUID{ UUID: rb.Data.UserId, Valid: true, },
-        IsChirpyRed: true,
+    param := database.CreateWebhookEventParams {
+        Source: "polka",
+        EventID: eventID,
+        EventType: rb.Event,
+        Payload: bodyData,
+    }
+    event, err := cfg.queries.CreateWebhookEvent(r.Context(), param)
+    if errors.Is(err, sql.ErrNoRows) {
+        // a redelivery, processWebhookEvent decides if it still needs applying
+        event, err = cfg.queries.GetWebhookEventBySourceID(r.Context(), database.GetWebhookEventBySourceIDParams{ Source: "polka", EventID: eventID })
     }
-
-    x, err := cfg.queries.UpdateRed(r.Context(), param)
     if err != nil {
+        logging.FromContext(r.Context()).Error("recording webhook event failed", "event_id", eventID, "err", err)
         w.Header().Set("Content-Type", "application/json; charset=utf-8")
-        w.WriteHeader(http.StatusNotFound)
+        w.WriteHeader(http.StatusInternalServerError)
         return
     }
 
-    fmt.Println(x)
+    // already handled events come back as 204 too, so Polka stops retrying
+    code, _, _ := cfg.processWebhookEvent(r.Context(), event.ID, false)
 
     w.Header().Set("Content-Type", "application/json; charset=utf-8")
-    w.WriteHeader(http.StatusNoContent)
+    w.WriteHeader(code)
+}
+
+// errWebhookHandled means the event was processed or ignored before, and
+// only a forced replay runs it again.
+var errWebhookHandled = errors.New("webhook event already handled")
+
+// processWebhookEvent claims a stored event, applies it and records the
+// outcome in one transaction, so however often an event is delivered it is
+// applied once. force runs already handled events again. It returns the
+// status code Polka should see.
+func (cfg *apiConfig) processWebhookEvent(ctx context.Context, eventID uuid.UUID, force bool) (int, database.WebhookEvent, error) {
+    tx, err := cfg.db.BeginTx(ctx, nil)
+    if err != nil {
+        logging.FromContext(ctx).Error("claiming webhook event failed", "id", eventID, "err", err)
+        return http.StatusInternalServerError, database.WebhookEvent{}, err
+    }
+    defer tx.Rollback()
+    qtx := cfg.queriesTx(tx)
+
+    event, err := qtx.ClaimWebhookEvent(ctx, database.ClaimWebhookEventParams{ ID: eventID, Force: force })
+    if errors.Is(err, sql.ErrNoRows) {
+        return http.StatusNoContent, event, errWebhookHandled
+    }
+    if err != nil {
+        logging.FromContext(ctx).Error("claiming webhook event failed", "id", eventID, "err", err)
+        return http.StatusInternalServerError, event, err
+    }
+
+    code, status, applyErr := cfg.applyPolkaEvent(ctx, qtx, event.EventID, event.Payload)
+
+    finish := database.FinishWebhookEventParams {
+        ID: event.ID,
+        Status: status,
+    }
+    if applyErr != nil {
+        // none of a half applied event is kept, only that it failed
+        tx.Rollback()
+        finish.Error = sql.NullString{ String: applyErr.Error(), Valid: true }
+        logging.FromContext(ctx).Warn("applying webhook event failed", "event_id", event.EventID, "event", event.EventType, "err", applyErr)
+        finished, err := cfg.queries.FinishWebhookEvent(ctx, finish)
+        if err != nil {
+            logging.FromContext(ctx).Error("finishing webhook event failed", "event_id", event.EventID, "err", err)
+            return http.StatusInternalServerError, event, err
+        }
+        return code, finished, nil
+    }
+
+    finished, err := qtx.FinishWebhookEvent(ctx, finish)
+    if err == nil {
+        err = tx.Commit()
+    }
+    if err != nil {
+        logging.FromContext(ctx).Error("finishing webhook event failed", "event_id", event.EventID, "err", err)
+        return http.StatusInternalServerError, event, err
+    }
+    return code, finished, nil
 }
 
 func (cfg *apiConfig) revokeRefreshToken(w http.ResponseWriter, r *http.Request) {
@@ -478,6 +1060,8 @@ func (cfg *apiConfig) revokeRefreshToken(w http.ResponseWriter, r *http.Request)
     w.WriteHeader(http.StatusNoContent)
 }
 
+// HandleHealthz is the liveness probe. It only says the process is up and
+// serving, dependencies are for /api/readyz to worry about.
 func HandleHealthz(writer http.ResponseWriter, request *http.Request)  {
     writer.Header().Set("Content-Type", "text/plain; charset=utf-8") // normal header
     writer.WriteHeader(http.StatusOK)
@@ -498,46 +1082,196 @@ func scrubMessage(message string) string  {
 }
 
 func main() {
+    err := run(os.Args[1:])
+    if err != nil {
+        slog.Error("chirpy failed", "err", err)
+        os.Exit(1)
+    }
+}
+
+// run loads the configuration and then runs the command named in args, see
+// commands, or else the API server.
+func run(args []string) error {
+    // .env only fills in what the real environment doesn't set
     godotenv.Load()
-    dbURL := os.Getenv("DB_URL")
-    platform := os.Getenv("PLATFORM")
-    sec := os.Getenv("SECRET")
-    pk := os.Getenv("POLKA_KEY")
+    conf, args, err := config.Load(args, os.LookupEnv)
+    if errors.Is(err, flag.ErrHelp) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("bad configuration: %w", err)
+    }
+    slog.SetDefault(logging.New(os.Stdout, conf.LogFormat, conf.LogLevel))
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    if len(args) != 0 {
+        return runCommand(ctx, conf, args)
+    }
+    return runServer(ctx, conf)
+}
 
-    db, err := sql.Open("postgres", dbURL)
+// runServer starts the server and blocks until it failed or was asked to
+// stop by SIGINT or SIGTERM, in which case it drains in flight requests and
+// stops the background jobs before returning.
+func runServer(ctx context.Context, conf config.Config) error {
+    err := conf.Validate()
     if err != nil {
-        fmt.Printf("database open failed")
-        return
+        return fmt.Errorf("bad configuration: %w", err)
+    }
+
+    db, err := openDB(ctx, conf)
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+
+    migrator, err := newMigrator(db)
+    if err != nil {
+        return err
+    }
+    if conf.AutoMigrate {
+        applied, err := migrator.Up(ctx)
+        for _, m := range applied {
+            slog.Info("applied migration", "migration", m.Name)
+        }
+        if err != nil {
+            return err
+        }
     }
-    dbQueries := database.New(db)
 
     theCounter := apiConfig{}
+    theCounter.metrics = newServerMetrics()
+    tracer, spanExporter := newTracer()
+    theCounter.tracer = tracer
+    if spanExporter != nil {
+        defer func() {
+            flushCtx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+            defer cancel()
+            spanExporter.Shutdown(flushCtx)
+        }()
+    }
+    theCounter.dbStats = &dbstats.DB {
+        DB: db,
+        Duration: theCounter.metrics.dbQueryDuration,
+        Errors: theCounter.metrics.dbQueryErrors,
+        Tracer: tracer,
+        SlowQuery: conf.SlowQueryThreshold,
+    }
+    dbQueries := database.New(theCounter.dbStats)
+    theCounter.metrics.registerSessionGauge(dbQueries)
+
+    theCounter.db = db
+    theCounter.migrator = migrator
     theCounter.queries = dbQueries
-    theCounter.platform = platform
-    theCounter.tokenSecret = sec
-    theCounter.polkaKey = pk
+    theCounter.platform = conf.Platform
+    theCounter.devFixtures = conf.DevFixtures
+    theCounter.tokenSecret = conf.Secret
+    theCounter.polkaKey = conf.PolkaKey
+    theCounter.adminKey = conf.AdminKey
+    theCounter.accessTokenTTL = conf.AccessTokenTTL
+    theCounter.refreshTokenTTL = conf.RefreshTokenTTL
+    theCounter.deletionGrace = conf.DeletionGrace
+    theCounter.exportTTL = conf.ExportTTL
+    theCounter.plans = entitlements.Default
+    theCounter.plans.Free.MaxChirpLength = conf.ChirpMaxLength
+    theCounter.plans.Red.MaxChirpLength = conf.RedChirpMaxLength
+    if len(conf.SMTPAddr) != 0 {
+        theCounter.mailer = mail.SMTPSender {
+            Addr: conf.SMTPAddr,
+            From: conf.MailFrom,
+            Username: conf.SMTPUsername,
+            Password: conf.SMTPPassword,
+        }
+    } else {
+        theCounter.mailer = mail.LogSender{ Out: os.Stdout }
+    }
+
+    theCounter.oidcProviders = loadOIDCProviders()
+
+    rateLimits, err := loadRateLimits(conf.RateLimits)
+    if err != nil {
+        return fmt.Errorf("bad rate limits: %w", err)
+    }
+
+    jobs := backgroundJobs{}
+    defer jobs.stop()
+    theCounter.rateLimits = rateLimits
+    theCounter.trustProxy = conf.TrustProxy
+    if conf.RateLimitBackend == "postgres" {
+        store := ratelimit.PostgresStore{ Queries: dbQueries }
+        theCounter.rateLimiter = store
+        jobs.start(ctx, func(ctx context.Context) {
+            sweepRateLimits(ctx, store, time.Minute)
+        })
+    } else {
+        theCounter.rateLimiter = ratelimit.NewMemoryStore()
+    }
 
     serveMux := http.NewServeMux()
     server := http.Server {
-        Handler: serveMux,
-        Addr: ":8080",
+        Handler: theCounter.MiddlewareTracing(theCounter.MiddlewareLogging(theCounter.MiddlewareMetrics(theCounter.MiddlewareSpanRoute(serveMux)))),
+        Addr: conf.Addr(),
+        ReadHeaderTimeout: conf.ReadHeaderTimeout,
+        ReadTimeout: conf.ReadTimeout,
+        WriteTimeout: conf.WriteTimeout,
+        IdleTimeout: conf.IdleTimeout,
     }
 
     serveMux.Handle("/app/", http.StripPrefix("/app",
         theCounter.MiddlewareMetricsInc(http.FileServer(http.Dir(".")))))
 
+    readiness := theCounter.readinessChecks()
     serveMux.HandleFunc("GET /api/healthz", HandleHealthz)
+    serveMux.HandleFunc("GET /api/livez", HandleHealthz)
+    serveMux.Handle("GET /api/readyz", readiness.Handler())
     serveMux.HandleFunc("GET /admin/metrics", theCounter.GetHits)
-    serveMux.HandleFunc("POST /api/users", theCounter.createUser)
-    serveMux.HandleFunc("POST /admin/reset", theCounter.resetHits)
-    serveMux.HandleFunc("POST /api/chirps", theCounter.createChirp)
+    serveMux.Handle("GET /metrics", theCounter.metrics.registry.Handler())
+    serveMux.Handle("POST /api/users", theCounter.MiddlewareRateLimit("signup", http.HandlerFunc(theCounter.createUser)))
+    serveMux.HandleFunc("POST /admin/reset", theCounter.devReset)
+    serveMux.Handle("POST /api/chirps", theCounter.MiddlewareRateLimit("chirps", http.HandlerFunc(theCounter.createChirp)))
     serveMux.HandleFunc("GET /api/chirps", theCounter.getChirps)
     serveMux.HandleFunc("GET /api/chirps/{chirpID}", theCounter.getChirpBy)
-    serveMux.HandleFunc("POST /api/login", theCounter.login)
+    serveMux.Handle("POST /api/login", theCounter.MiddlewareRateLimit("login", http.HandlerFunc(theCounter.login)))
     serveMux.HandleFunc("POST /api/refresh", theCounter.refreshToken)
     serveMux.HandleFunc("POST /api/revoke", theCounter.revokeRefreshToken)
     serveMux.HandleFunc("PUT /api/users", theCounter.updateUser)
+    serveMux.HandleFunc("DELETE /api/users", theCounter.deleteAccount)
+    serveMux.HandleFunc("GET /api/users/{userID}", theCounter.getProfile)
+    serveMux.HandleFunc("GET /api/users/by-username/{username}", theCounter.getProfileByUsername)
+    serveMux.HandleFunc("PUT /api/users/me/profile", theCounter.updateProfile)
     serveMux.HandleFunc("DELETE /api/chirps/{chirpID}", theCounter.deleteChirp)
+    serveMux.Handle("PUT /api/chirps/{chirpID}", theCounter.MiddlewareRateLimit("chirps", http.HandlerFunc(theCounter.editChirp)))
     serveMux.HandleFunc("POST /api/polka/webhooks", theCounter.chirpyRedPayment)
-    server.ListenAndServe()
+    serveMux.Handle("POST /api/login/mfa", theCounter.MiddlewareRateLimit("login_mfa", http.HandlerFunc(theCounter.loginMFA)))
+    serveMux.HandleFunc("POST /api/users/mfa/totp", theCounter.enrollTOTP)
+    serveMux.HandleFunc("POST /api/users/mfa/totp/confirm", theCounter.confirmTOTP)
+    serveMux.HandleFunc("DELETE /api/users/mfa/totp", theCounter.disableTOTP)
+    serveMux.HandleFunc("GET /api/auth/{provider}/login", theCounter.oidcLogin)
+    serveMux.HandleFunc("GET /api/auth/{provider}/callback", theCounter.oidcCallback)
+    serveMux.HandleFunc("POST /api/oauth/clients", theCounter.registerOAuthClient)
+    serveMux.HandleFunc("POST /api/oauth/authorize", theCounter.authorizeOAuthClient)
+    serveMux.Handle("POST /api/oauth/token", theCounter.MiddlewareRateLimit("oauth_token", http.HandlerFunc(theCounter.oauthToken)))
+    serveMux.HandleFunc("POST /api/users/me/api-keys", theCounter.createAPIKey)
+    serveMux.HandleFunc("GET /api/users/me/api-keys", theCounter.listAPIKeys)
+    serveMux.HandleFunc("DELETE /api/users/me/api-keys/{keyID}", theCounter.deleteAPIKey)
+    serveMux.HandleFunc("GET /api/users/me/subscription", theCounter.getMySubscription)
+    serveMux.HandleFunc("POST /api/users/me/export", theCounter.requestExport)
+    serveMux.HandleFunc("GET /api/users/me/export", theCounter.downloadExport)
+    serveMux.HandleFunc("GET /admin/webhooks", theCounter.listWebhookEvents)
+    serveMux.HandleFunc("GET /admin/webhooks/{eventID}", theCounter.getWebhookEvent)
+    serveMux.HandleFunc("POST /admin/webhooks/{eventID}/replay", theCounter.replayWebhookEvent)
+    serveMux.HandleFunc("POST /admin/users/{userID}/restore", theCounter.restoreAccount)
+    jobs.start(ctx, func(ctx context.Context) {
+        theCounter.expireSubscriptions(ctx, time.Minute)
+    })
+    jobs.start(ctx, func(ctx context.Context) {
+        theCounter.purgeDeletedUsers(ctx, time.Hour)
+    })
+    jobs.start(ctx, func(ctx context.Context) {
+        theCounter.runExports(ctx, 10 * time.Second)
+    })
+
+    return serve(ctx, &server, readiness, conf.ShutdownDelay, conf.ShutdownTimeout)
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/trice/Chirpy/internal/database"
+	"github.com/trice/Chirpy/internal/metrics"
+)
+
+type serverMetrics struct {
+    registry *metrics.Registry
+    fileserverHits *metrics.Counter
+    requests *metrics.Counter
+    requestDuration *metrics.Histogram
+    dbQueryDuration *metrics.Histogram
+    dbQueryErrors *metrics.Counter
+    chirpsCreated *metrics.Counter
+}
+
+func newServerMetrics() *serverMetrics {
+    reg := metrics.NewRegistry()
+    return &serverMetrics {
+        registry: reg,
+        fileserverHits: reg.NewCounter("chirpy_fileserver_hits_total", "Requests for the static app files."),
+        requests: reg.NewCounter("chirpy_http_requests_total", "HTTP requests by route, method and status code.", "route", "method", "status"),
+        requestDuration: reg.NewHistogram("chirpy_http_request_duration_seconds", "HTTP request latency by route.", metrics.DefBuckets, "route", "method"),
+        dbQueryDuration: reg.NewHistogram("chirpy_db_query_duration_seconds", "Database query latency by sqlc query name.", metrics.DefBuckets, "query"),
+        dbQueryErrors: reg.NewCounter("chirpy_db_query_errors_total", "Failed database queries by sqlc query name.", "query"),
+        chirpsCreated: reg.NewCounter("chirpy_chirps_created_total", "Chirps created."),
+    }
+}
+
+// registerSessionGauge exposes the number of live refresh tokens, which is
+// as close as a stateless API gets to active sessions
+func (m *serverMetrics) registerSessionGauge(queries *database.Queries) {
+    m.registry.NewGaugeFunc("chirpy_active_sessions", "Refresh tokens that are neither expired nor revoked.", func() (float64, error) {
+        ctx, cancel := context.WithTimeout(context.Background(), 2 * time.Second)
+        defer cancel()
+        n, err := queries.CountActiveRefreshTokens(ctx)
+        return float64(n), err
+    })
+}
+
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+    if s.status == 0 {
+        s.status = code
+    }
+    s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+    if s.status == 0 {
+        s.status = http.StatusOK
+    }
+    return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+    return s.ResponseWriter
+}
+
+// MiddlewareMetrics counts and times every request. It wraps the whole mux
+// and labels by the matched pattern rather than the raw path, so IDs in URLs
+// don't blow up the number of series.
+func (cfg *apiConfig) MiddlewareMetrics(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        rec := &statusRecorder{ ResponseWriter: w }
+        next.ServeHTTP(rec, r)
+
+        route := r.Pattern
+        if len(route) == 0 {
+            route = "unmatched"
+        }
+        if rec.status == 0 {
+            rec.status = http.StatusOK
+        }
+        cfg.metrics.requests.Inc(route, r.Method, strconv.Itoa(rec.status))
+        cfg.metrics.requestDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+    })
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/database"
+)
+
+// enrollTOTP starts 2FA setup by generating a new secret. Nothing is enforced
+// until the user proves their authenticator works via confirmTOTP.
+func (cfg *apiConfig) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    userRow, err := cfg.queries.GetUserById(r.Context(), validUuid)
+    if err != nil {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    existing, err := cfg.queries.GetTOTPForUser(r.Context(), validUuid)
+    if err == nil && existing.ConfirmedAt.Valid {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusConflict)
+        w.Write([]byte(`{"error":"two-factor authentication is already enabled"}`))
+        return
+    }
+
+    secret, err := auth.MakeTOTPSecret()
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    param := database.UpsertTOTPSecretParams {
+        UserID: validUuid,
+        Secret: secret,
+    }
+    err = cfg.queries.UpsertTOTPSecret(r.Context(), param)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    type out struct {
+        Secret string `json:"secret"`
+        OtpauthURI string `json:"otpauth_uri"`
+    }
+    d, _ := json.Marshal(out{ secret, auth.TOTPURI("Chirpy", userRow.Email, secret) })
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusCreated)
+    w.Write(d)
+}
+
+// confirmTOTP turns 2FA on once the first code checks out and hands back the
+// recovery codes. This is the only time the plain codes are ever shown.
+func (cfg *apiConfig) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    type body struct {
+        Code string `json:"code"`
+    }
+    data, err := io.ReadAll(r.Body)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    rb := body{}
+    err = json.Unmarshal(data, &rb)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    totp, err := cfg.queries.GetTOTPForUser(r.Context(), validUuid)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusNotFound)
+        w.Write([]byte(`{"error":"two-factor authentication has not been set up"}`))
+        return
+    }
+
+    if totp.ConfirmedAt.Valid {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusConflict)
+        w.Write([]byte(`{"error":"two-factor authentication is already enabled"}`))
+        return
+    }
+
+    step, err := auth.ValidateTOTP(totp.Secret, rb.Code, time.Now())
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        w.Write([]byte(`{"error":"invalid code"}`))
+        return
+    }
+
+    codes, err := auth.MakeRecoveryCodes(10)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    // a code error half way through shouldn't leave 2FA on with only some
+    // of the recovery codes stored
+    tx, err := cfg.db.BeginTx(r.Context(), nil)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+    defer tx.Rollback()
+    qtx := cfg.queriesTx(tx)
+
+    err = qtx.DeleteRecoveryCodesForUser(r.Context(), validUuid)
+    for _, code := range codes {
+        if err != nil {
+            break
+        }
+        param := database.CreateRecoveryCodeParams {
+            UserID: validUuid,
+            CodeHash: auth.HashToken(code),
+        }
+        err = qtx.CreateRecoveryCode(r.Context(), param)
+    }
+    if err == nil {
+        err = qtx.ConfirmTOTP(r.Context(), database.ConfirmTOTPParams{ UserID: validUuid, LastUsedStep: step })
+    }
+    if err == nil {
+        err = tx.Commit()
+    }
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    type out struct {
+        RecoveryCodes []string `json:"recovery_codes"`
+    }
+    d, _ := json.Marshal(out{ codes })
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    w.Write(d)
+}
+
+// disableTOTP turns 2FA off again. That takes an unused recovery code, or
+// what requireReauth wants: the password, or a fresh sign in for accounts
+// without one.
+func (cfg *apiConfig) disableTOTP(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    type body struct {
+        CurrentPassword string `json:"current_password"`
+        ReauthToken string `json:"reauth_token"`
+        RecoveryCode string `json:"recovery_code"`
+    }
+    data, err := io.ReadAll(r.Body)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    rb := body{}
+    err = json.Unmarshal(data, &rb)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    userRow, err := cfg.queries.GetUserById(r.Context(), validUuid)
+    if err != nil {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    if len(rb.RecoveryCode) != 0 {
+        // guesses count against the same per account limit as at login
+        if !cfg.takeUserAttempt(w, r, "login_mfa_user", validUuid) {
+            return
+        }
+        param := database.UseRecoveryCodeParams {
+            UserID: validUuid,
+            CodeHash: auth.HashToken(rb.RecoveryCode),
+        }
+        used, err := cfg.queries.UseRecoveryCode(r.Context(), param)
+        if err != nil || used == 0 {
+            w.Header().Set("Content-Type", "application/json; charset=utf-8")
+            w.WriteHeader(http.StatusForbidden)
+            w.Write([]byte(`{"error":"invalid recovery code"}`))
+            return
+        }
+    } else if !cfg.requireReauth(w, r, userRow, rb.CurrentPassword, rb.ReauthToken) {
+        return
+    }
+
+    // half of it gone would leave 2FA on with no way to recover
+    tx, err := cfg.db.BeginTx(r.Context(), nil)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+    defer tx.Rollback()
+    qtx := cfg.queriesTx(tx)
+
+    err = qtx.DeleteRecoveryCodesForUser(r.Context(), validUuid)
+    if err == nil {
+        err = qtx.DeleteTOTPForUser(r.Context(), validUuid)
+    }
+    if err == nil {
+        err = tx.Commit()
+    }
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// loginMFA is the second step of login for users with 2FA. It trades the
+// challenge token from login plus a TOTP or recovery code for real tokens.
+func (cfg *apiConfig) loginMFA(w http.ResponseWriter, r *http.Request) {
+    type body struct {
+        MFAToken string `json:"mfa_token"`
+        Code string `json:"code"`
+        RecoveryCode string `json:"recovery_code"`
+    }
+    data, err := io.ReadAll(r.Body)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    rb := body{}
+    err = json.Unmarshal(data, &rb)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    userID, err := auth.ValidateMFAToken(rb.MFAToken, cfg.tokenSecret)
+    if err != nil {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    if !cfg.takeUserAttempt(w, r, "login_mfa_user", userID) {
+        return
+    }
+
+    totp, err := cfg.queries.GetTOTPForUser(r.Context(), userID)
+    if err != nil || !totp.ConfirmedAt.Valid {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    if len(rb.RecoveryCode) != 0 {
+        param := database.UseRecoveryCodeParams {
+            UserID: userID,
+            CodeHash: auth.HashToken(rb.RecoveryCode),
+        }
+        used, err := cfg.queries.UseRecoveryCode(r.Context(), param)
+        if err != nil || used == 0 {
+            w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+    } else {
+        step, err := auth.ValidateTOTP(totp.Secret, rb.Code, time.Now())
+        if err != nil {
+            w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+
+        // each code only works once, even inside its 30 second window
+        param := database.UseTOTPStepParams {
+            UserID: userID,
+            LastUsedStep: step,
+        }
+        used, err := cfg.queries.UseTOTPStep(r.Context(), param)
+        if err != nil || used == 0 {
+            w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+    }
+
+    userRow, err := cfg.queries.GetUserById(r.Context(), userID)
+    if err != nil {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    cfg.issueSession(w, r, userRow)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/ratelimit"
+)
+
+func TestLoginMFAAttemptLimit(t *testing.T) {
+    cfg, db := newTestConfig(t)
+    cfg.rateLimits["login_mfa_user"] = ratelimit.Limit{ Rate: 3, Per: time.Hour, Burst: 3 }
+    userID := uuid.New()
+    db.on("GetTOTPForUser", func(args []driver.Value) fakeResult {
+        return rows("user_id,secret,created_at,confirmed_at,last_used_step", row(userID, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Now(), time.Now(), 0))
+    })
+    db.on("UseRecoveryCode", func([]driver.Value) fakeResult { return affected(0) })
+
+    mfaToken, err := auth.MakeMFAToken(userID, cfg.tokenSecret, time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    body := fmt.Sprintf(`{"mfa_token": %q, "recovery_code": "00000-00000-00000-00000"}`, mfaToken)
+
+    // every request comes from a new address, only the account is the same
+    for i := 0; i < 3; i++ {
+        w := do(cfg.loginMFA, "POST", "/api/login/mfa", "", body)
+        if w.Code != http.StatusUnauthorized {
+            t.Fatalf("attempt %d status = %d, want %d", i + 1, w.Code, http.StatusUnauthorized)
+        }
+    }
+    w := do(cfg.loginMFA, "POST", "/api/login/mfa", "", body)
+    if w.Code != http.StatusTooManyRequests {
+        t.Fatalf("attempt 4 status = %d, want %d", w.Code, http.StatusTooManyRequests)
+    }
+    if n := len(db.called("UseRecoveryCode")); n != 3 {
+        t.Errorf("UseRecoveryCode called %d times, want 3", n)
+    }
+}
+
+func TestDisableTOTP(t *testing.T) {
+    tests := []struct {
+        name string
+        noPassword bool
+        body string
+        // see reauthToken
+        reauth string
+        recoveryCodeOK bool
+        wantStatus int
+    }{
+        {
+            name: "Right password",
+            body: `{"current_password": "hunter2"}`,
+            wantStatus: http.StatusNoContent,
+        },
+        {
+            name: "Wrong password",
+            body: `{"current_password": "nope"}`,
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Identity provider account without a fresh sign in",
+            noPassword: true,
+            body: `{}`,
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Identity provider account with a fresh sign in",
+            noPassword: true,
+            reauth: "self",
+            wantStatus: http.StatusNoContent,
+        },
+        {
+            name: "Identity provider account with a recovery code",
+            noPassword: true,
+            body: `{"recovery_code": "00000-00000-00000-00000"}`,
+            recoveryCodeOK: true,
+            wantStatus: http.StatusNoContent,
+        },
+        {
+            name: "Used or wrong recovery code",
+            body: `{"recovery_code": "00000-00000-00000-00000"}`,
+            wantStatus: http.StatusForbidden,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            userID := uuid.New()
+            user := testUser{ id: userID, email: "a@example.com", hash: mustHash(t, "hunter2") }
+            if tt.noPassword {
+                user.hash = ""
+            }
+            db.serveUser(user)
+            db.on("UseRecoveryCode", func(args []driver.Value) fakeResult {
+                if tt.recoveryCodeOK && args[1] == auth.HashToken("00000-00000-00000-00000") {
+                    return affected(1)
+                }
+                return affected(0)
+            })
+            db.on("DeleteRecoveryCodesForUser", nil)
+            db.on("DeleteTOTPForUser", nil)
+
+            body := tt.body
+            if len(tt.reauth) != 0 {
+                body = `{"reauth_token": "` + reauthToken(t, cfg, userID, tt.reauth) + `"}`
+            }
+            w := do(cfg.disableTOTP, "DELETE", "/api/users/mfa/totp", bearer(t, cfg, userID), body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("disableTOTP() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if disabled := len(db.called("DeleteTOTPForUser")) != 0; disabled != (tt.wantStatus == http.StatusNoContent) {
+                t.Errorf("DeleteTOTPForUser called = %v", disabled)
+            }
+        })
+    }
+}
+
+func TestDisableTOTPFailure(t *testing.T) {
+    cfg, db := newTestConfig(t)
+    userID := uuid.New()
+    db.serveUser(testUser{ id: userID, email: "a@example.com", hash: mustHash(t, "hunter2") })
+    db.on("DeleteRecoveryCodesForUser", nil)
+    db.on("DeleteTOTPForUser", func([]driver.Value) fakeResult {
+        return fakeResult{ err: fmt.Errorf("connection reset") }
+    })
+
+    w := do(cfg.disableTOTP, "DELETE", "/api/users/mfa/totp", bearer(t, cfg, userID), `{"current_password": "hunter2"}`)
+    if w.Code != http.StatusInternalServerError {
+        t.Fatalf("disableTOTP() status = %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body)
+    }
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/database"
+)
+
+// registerOAuthClient lets a user register a third party app. Confidential
+// clients get a secret which, like the recovery codes, is only shown once.
+func (cfg *apiConfig) registerOAuthClient(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    type body struct {
+        Name string `json:"name"`
+        RedirectURI string `json:"redirect_uri"`
+        Confidential bool `json:"confidential"`
+    }
+    data, err := io.ReadAll(r.Body)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    rb := body{}
+    err = json.Unmarshal(data, &rb)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    if len(rb.Name) == 0 || !validRedirectURI(rb.RedirectURI) {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"name and an https redirect_uri are required"}`))
+        return
+    }
+
+    var secret string
+    param := database.CreateOAuthClientParams {
+        Name: rb.Name,
+        RedirectUri: rb.RedirectURI,
+        UserID: validUuid,
+    }
+    if rb.Confidential {
+        secret, _ = auth.MakeRefreshToken()
+        param.SecretHash = sql.NullString{ String: auth.HashToken(secret), Valid: true }
+    }
+
+    client, err := cfg.queries.CreateOAuthClient(r.Context(), param)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    type out struct {
+        ClientID uuid.UUID `json:"client_id"`
+        ClientSecret string `json:"client_secret,omitempty"`
+        Name string `json:"name"`
+        RedirectURI string `json:"redirect_uri"`
+    }
+    d, _ := json.Marshal(out{ client.ID, secret, client.Name, client.RedirectUri })
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusCreated)
+    w.Write(d)
+}
+
+// validRedirectURI only lets codes go to https, or to plain http on the
+// app's own machine for native apps (RFC 8252), and never to a URI with a
+// fragment or credentials in it.
+func validRedirectURI(raw string) bool {
+    redirect, err := url.Parse(raw)
+    if err != nil || len(redirect.Host) == 0 || strings.Contains(raw, "#") || redirect.User != nil {
+        return false
+    }
+    switch redirect.Scheme {
+    case "https":
+        return true
+    case "http":
+        host := redirect.Hostname()
+        if host == "localhost" {
+            return true
+        }
+        ip := net.ParseIP(host)
+        return ip != nil && ip.IsLoopback()
+    }
+    return false
+}
+
+// authorizeOAuthClient records the signed in user's consent and returns
+// where to send the browser next, with the authorization code attached.
+// Rendering the consent screen is left to the first party front end.
+func (cfg *apiConfig) authorizeOAuthClient(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    type body struct {
+        ClientID uuid.UUID `json:"client_id"`
+        RedirectURI string `json:"redirect_uri"`
+        Scope string `json:"scope"`
+        State string `json:"state"`
+        CodeChallenge string `json:"code_challenge"`
+        CodeChallengeMethod string `json:"code_challenge_method"`
+    }
+    data, err := io.ReadAll(r.Body)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    rb := body{}
+    err = json.Unmarshal(data, &rb)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    client, err := cfg.queries.GetOAuthClient(r.Context(), rb.ClientID)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"unknown client"}`))
+        return
+    }
+
+    // never redirect anywhere but the registered URI, or codes leak
+    if rb.RedirectURI != client.RedirectUri {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"redirect_uri does not match"}`))
+        return
+    }
+
+    if rb.CodeChallengeMethod != "S256" || len(rb.CodeChallenge) == 0 {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"a S256 code_challenge is required"}`))
+        return
+    }
+
+    scopes, err := auth.ParseScopes(rb.Scope)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"invalid_scope"}`))
+        return
+    }
+
+    code, _ := auth.MakeRefreshToken()
+    param := database.CreateOAuthCodeParams {
+        CodeHash: auth.HashToken(code),
+        ClientID: client.ID,
+        UserID: validUuid,
+        RedirectUri: client.RedirectUri,
+        Scope: strings.Join(scopes, " "),
+        CodeChallenge: rb.CodeChallenge,
+        ExpiresAt: time.Now().Add(10 * time.Minute),
+    }
+    err = cfg.queries.CreateOAuthCode(r.Context(), param)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    redirect, _ := url.Parse(client.RedirectUri)
+    q := redirect.Query()
+    q.Set("code", code)
+    if len(rb.State) != 0 {
+        q.Set("state", rb.State)
+    }
+    redirect.RawQuery = q.Encode()
+
+    type out struct {
+        RedirectTo string `json:"redirect_to"`
+    }
+    d, _ := json.Marshal(out{ redirect.String() })
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    w.Write(d)
+}
+
+// oauthToken is the RFC 6749 token endpoint, it only knows the
+// authorization_code grant and always requires PKCE.
+func (cfg *apiConfig) oauthToken(w http.ResponseWriter, r *http.Request) {
+    tokenError := func(code int, reason string) {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.Header().Set("Cache-Control", "no-store")
+        w.WriteHeader(code)
+        w.Write([]byte(`{"error":"` + reason + `"}`))
+    }
+
+    err := r.ParseForm()
+    if err != nil {
+        tokenError(http.StatusBadRequest, "invalid_request")
+        return
+    }
+
+    if r.PostForm.Get("grant_type") != "authorization_code" {
+        tokenError(http.StatusBadRequest, "unsupported_grant_type")
+        return
+    }
+
+    // confidential clients may use either basic auth or the form
+    clientIDText, clientSecret, basic := r.BasicAuth()
+    if basic {
+        clientIDText, _ = url.QueryUnescape(clientIDText)
+        clientSecret, _ = url.QueryUnescape(clientSecret)
+    } else {
+        clientIDText = r.PostForm.Get("client_id")
+        clientSecret = r.PostForm.Get("client_secret")
+    }
+
+    clientID, err := uuid.Parse(clientIDText)
+    if err != nil {
+        tokenError(http.StatusUnauthorized, "invalid_client")
+        return
+    }
+
+    client, err := cfg.queries.GetOAuthClient(r.Context(), clientID)
+    if err != nil {
+        tokenError(http.StatusUnauthorized, "invalid_client")
+        return
+    }
+
+    if client.SecretHash.Valid {
+        given := auth.HashToken(clientSecret)
+        if subtle.ConstantTimeCompare([]byte(given), []byte(client.SecretHash.String)) != 1 {
+            tokenError(http.StatusUnauthorized, "invalid_client")
+            return
+        }
+    }
+
+    // consuming is atomic so a code can only ever be exchanged once
+    code, err := cfg.queries.ConsumeOAuthCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+    if err != nil ||
+        code.ClientID != client.ID ||
+        code.RedirectUri != r.PostForm.Get("redirect_uri") ||
+        code.ExpiresAt.Before(time.Now()) ||
+        !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+        tokenError(http.StatusBadRequest, "invalid_grant")
+        return
+    }
+
+    // the account may have been switched off since the code was issued
+    _, err = cfg.activeUser(r.Context(), code.UserID)
+    if errors.Is(err, errAccountInactive) || errors.Is(err, sql.ErrNoRows) {
+        tokenError(http.StatusBadRequest, "invalid_grant")
+        return
+    }
+    if err != nil {
+        tokenError(http.StatusInternalServerError, "server_error")
+        return
+    }
+
+    expiresIn := cfg.accessTokenTTL
+    scopes := strings.Fields(code.Scope)
+    accessToken, err := auth.MakeJWT(code.UserID, cfg.tokenSecret, expiresIn, scopes...)
+    if err != nil {
+        tokenError(http.StatusInternalServerError, "server_error")
+        return
+    }
+
+    type out struct {
+        AccessToken string `json:"access_token"`
+        TokenType string `json:"token_type"`
+        ExpiresIn int `json:"expires_in"`
+        Scope string `json:"scope"`
+    }
+    d, _ := json.Marshal(out{ accessToken, "Bearer", int(expiresIn.Seconds()), code.Scope })
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(http.StatusOK)
+    w.Write(d)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRegisterOAuthClient(t *testing.T) {
+    tests := []struct {
+        name string
+        redirectURI string
+        wantStatus int
+    }{
+        {
+            name: "https",
+            redirectURI: "https://app.example.com/callback",
+            wantStatus: http.StatusCreated,
+        },
+        {
+            name: "http on localhost",
+            redirectURI: "http://localhost:8080/callback",
+            wantStatus: http.StatusCreated,
+        },
+        {
+            name: "http on the IPv4 loopback",
+            redirectURI: "http://127.0.0.1:8080/callback",
+            wantStatus: http.StatusCreated,
+        },
+        {
+            name: "http on the IPv6 loopback",
+            redirectURI: "http://[::1]:8080/callback",
+            wantStatus: http.StatusCreated,
+        },
+        {
+            name: "http anywhere else",
+            redirectURI: "http://app.example.com/callback",
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "javascript",
+            redirectURI: "javascript:alert(document.cookie)",
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "data",
+            redirectURI: "data:text/html,<script>alert(1)</script>",
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "Other schemes",
+            redirectURI: "ftp://app.example.com/callback",
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "Fragment",
+            redirectURI: "https://app.example.com/callback#x",
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "Empty fragment",
+            redirectURI: "https://app.example.com/callback#",
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "Userinfo",
+            redirectURI: "https://app.example.com@evil.example.com/callback",
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "Relative",
+            redirectURI: "/callback",
+            wantStatus: http.StatusBadRequest,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            userID := uuid.New()
+            db.serveUser(testUser{ id: userID, email: "a@example.com" })
+            db.on("CreateOAuthClient", func(args []driver.Value) fakeResult {
+                return rows("id,name,redirect_uri,secret_hash,user_id,created_at", row(uuid.New(), args[0], args[1], nil, args[3], time.Now()))
+            })
+
+            body := `{"name": "app", "redirect_uri": "` + tt.redirectURI + `"}`
+            w := do(cfg.registerOAuthClient, "POST", "/api/oauth/clients", bearer(t, cfg, userID), body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("registerOAuthClient() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+
+            wantCalls := 0
+            if tt.wantStatus == http.StatusCreated {
+                wantCalls = 1
+            }
+            if n := len(db.called("CreateOAuthClient")); n != wantCalls {
+                t.Errorf("CreateOAuthClient called %d times, want %d", n, wantCalls)
+            }
+        })
+    }
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/trice/Chirpy/internal/database"
+	"github.com/trice/Chirpy/internal/logging"
+	"github.com/trice/Chirpy/internal/profile"
+)
+
+// the profile queries all return the same columns, convert the others to
+// this one
+func publicProfile(row database.GetPublicProfileRow) profile.Public {
+    return profile.Public {
+        ID: row.ID,
+        Username: row.Username.String,
+        DisplayName: row.DisplayName,
+        Bio: row.Bio,
+        AvatarURL: row.AvatarUrl,
+        CreatedAt: row.CreatedAt,
+    }
+}
+
+func writeProfile(w http.ResponseWriter, p profile.Public) {
+    d, _ := json.Marshal(p)
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    w.Write(d)
+}
+
+func (cfg *apiConfig) getProfile(w http.ResponseWriter, r *http.Request) {
+    userID, err := uuid.Parse(r.PathValue("userID"))
+    if err != nil {
+        http.Error(w, "user not found", http.StatusNotFound)
+        return
+    }
+
+    row, err := cfg.queries.GetPublicProfile(r.Context(), userID)
+    if errors.Is(err, sql.ErrNoRows) {
+        http.Error(w, "user not found", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, "Error reading user", http.StatusInternalServerError)
+        return
+    }
+    writeProfile(w, publicProfile(row))
+}
+
+func (cfg *apiConfig) getProfileByUsername(w http.ResponseWriter, r *http.Request) {
+    row, err := cfg.queries.GetPublicProfileByUsername(r.Context(), r.PathValue("username"))
+    if errors.Is(err, sql.ErrNoRows) {
+        http.Error(w, "user not found", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, "Error reading user", http.StatusInternalServerError)
+        return
+    }
+    writeProfile(w, publicProfile(database.GetPublicProfileRow(row)))
+}
+
+// updateProfile changes the caller's public profile. Fields left out of the
+// body stay as they are, an empty username removes it.
+func (cfg *apiConfig) updateProfile(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    type body struct {
+        Username *string `json:"username"`
+        DisplayName *string `json:"display_name"`
+        Bio *string `json:"bio"`
+        AvatarURL *string `json:"avatar_url"`
+    }
+    data, err := io.ReadAll(r.Body)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    rb := body{}
+    err = json.Unmarshal(data, &rb)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+
+    userRow, err := cfg.queries.GetUserById(r.Context(), validUuid)
+    if err != nil {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    fields := profile.Fields {
+        Username: userRow.Username.String,
+        DisplayName: userRow.DisplayName,
+        Bio: userRow.Bio,
+        AvatarURL: userRow.AvatarUrl,
+    }
+    if rb.Username != nil {
+        fields.Username = *rb.Username
+    }
+    if rb.DisplayName != nil {
+        fields.DisplayName = *rb.DisplayName
+    }
+    if rb.Bio != nil {
+        fields.Bio = *rb.Bio
+    }
+    if rb.AvatarURL != nil {
+        fields.AvatarURL = *rb.AvatarURL
+    }
+
+    fields, err = fields.Clean()
+    if err != nil {
+        d, _ := json.Marshal(map[string]string{ "error": err.Error() })
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusBadRequest)
+        w.Write(d)
+        return
+    }
+
+    param := database.UpdateProfileParams {
+        ID: validUuid,
+        Username: sql.NullString{ String: fields.Username, Valid: len(fields.Username) != 0 },
+        DisplayName: fields.DisplayName,
+        Bio: fields.Bio,
+        AvatarUrl: fields.AvatarURL,
+    }
+    row, err := cfg.queries.UpdateProfile(r.Context(), param)
+    if err != nil {
+        var pqErr *pq.Error
+        if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+            w.Header().Set("Content-Type", "application/json; charset=utf-8")
+            w.WriteHeader(http.StatusConflict)
+            w.Write([]byte(`{"error":"username already taken"}`))
+            return
+        }
+        logging.FromContext(r.Context()).Error("updating profile failed", "err", err)
+        w.Header().Set("Content-Type", "application/json; charset=utf-8")
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"error":"something went wrong"}`))
+        return
+    }
+    writeProfile(w, publicProfile(database.GetPublicProfileRow(row)))
+}
+
+// chirpWithAuthor is a chirp as returned with ?embed=author
+type chirpWithAuthor struct {
+    database.Chirp
+    Author *profile.Public `json:"author"`
+}
+
+func wantsAuthor(r *http.Request) bool {
+    return r.URL.Query().Get("embed") == "author"
+}
+
+// embedAuthors looks up the authors of chirps in one query. Authors that
+// can't be shown come out as null.
+func (cfg *apiConfig) embedAuthors(ctx context.Context, chirps []database.Chirp) ([]chirpWithAuthor, error) {
+    ids := []uuid.UUID{}
+    seen := map[uuid.UUID]bool{}
+    for _, c := range chirps {
+        if !seen[c.UserID] {
+            seen[c.UserID] = true
+            ids = append(ids, c.UserID)
+        }
+    }
+
+    rows, err := cfg.queries.ListPublicProfiles(ctx, ids)
+    if err != nil {
+        return nil, err
+    }
+    authors := map[uuid.UUID]*profile.Public{}
+    for _, row := range rows {
+        p := publicProfile(database.GetPublicProfileRow(row))
+        authors[p.ID] = &p
+    }
+
+    out := make([]chirpWithAuthor, len(chirps))
+    for i, c := range chirps {
+        out[i] = chirpWithAuthor{ c, authors[c.UserID] }
+    }
+    return out, nil
+}
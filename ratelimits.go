@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/entitlements"
+	"github.com/trice/Chirpy/internal/ratelimit"
+)
+
+// defaultRateLimits are per key, a key being the signed in user or else the
+// client IP. The rate_limits.limits setting can override them like
+// "login=5/m,chirps=100/h".
+var defaultRateLimits = map[string]ratelimit.Limit {
+    "login": ratelimit.PerMinute(10),
+    "login_mfa": ratelimit.PerMinute(5),
+    "signup": ratelimit.PerMinute(5),
+    "chirps": ratelimit.PerMinute(entitlements.Free.ChirpsPerMinute),
+    "oauth_token": ratelimit.PerMinute(30),
+    // second factor attempts per account rather than per client, see
+    // takeUserAttempt
+    "login_mfa_user": { Rate: 10, Per: 15 * time.Minute, Burst: 10 },
+}
+
+func loadRateLimits(overrides string) (map[string]ratelimit.Limit, error) {
+    limits := map[string]ratelimit.Limit{}
+    for route, limit := range defaultRateLimits {
+        limits[route] = limit
+    }
+
+    for _, entry := range strings.Split(overrides, ",") {
+        if len(strings.TrimSpace(entry)) == 0 {
+            continue
+        }
+        route, value, ok := strings.Cut(entry, "=")
+        if !ok {
+            return nil, fmt.Errorf("Invalid RATE_LIMITS entry %q", entry)
+        }
+        limit, err := ratelimit.ParseLimit(value)
+        if err != nil {
+            return nil, err
+        }
+        limits[strings.TrimSpace(route)] = limit
+    }
+    return limits, nil
+}
+
+// redRateLimits are the routes where Chirpy Red members get what their plan
+// allows instead of the configured limit
+var redRateLimits = map[string]func(entitlements.Entitlements) ratelimit.Limit {
+    "chirps": func(e entitlements.Entitlements) ratelimit.Limit { return ratelimit.PerMinute(e.ChirpsPerMinute) },
+}
+
+// MiddlewareRateLimit limits next with the limit configured for route, or
+// the Red plan's one if the caller has Chirpy Red, see redRateLimits. The
+// token is checked once for the limiter and next together.
+func (cfg *apiConfig) MiddlewareRateLimit(route string, next http.Handler) http.Handler {
+    limit, ok := cfg.rateLimits[route]
+    if !ok || cfg.rateLimiter == nil {
+        return next
+    }
+    limited := ratelimit.Middleware(cfg.rateLimiter, route, limit, cfg.rateLimitKey, next)
+
+    redLimit, ok := redRateLimits[route]
+    if !ok {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            limited.ServeHTTP(w, withRequestAuth(r))
+        })
+    }
+    redLimited := ratelimit.Middleware(cfg.rateLimiter, route + "_red", redLimit(cfg.plans.Red), cfg.rateLimitKey, next)
+
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        r = withRequestAuth(r)
+        userRow, err := cfg.requestUser(r)
+        if err == nil && userRow.IsChirpyRed {
+            redLimited.ServeHTTP(w, r)
+            return
+        }
+        limited.ServeHTTP(w, r)
+    })
+}
+
+// signed in users get a bucket of their own, which is fairer than sharing
+// one with everybody behind the same NAT
+func (cfg *apiConfig) rateLimitKey(r *http.Request) string {
+    p, err := authenticateRequest(r, cfg)
+    if err == nil {
+        return "user:" + p.userID.String()
+    }
+    return "ip:" + ratelimit.ClientIP(r, cfg.trustProxy)
+}
+
+// takeUserAttempt counts an attempt against userID's own bucket for route,
+// on top of the per client limit of the middleware. Guesses spread over many
+// addresses still run out. Like the middleware it lets the attempt through
+// when the store fails.
+func (cfg *apiConfig) takeUserAttempt(w http.ResponseWriter, r *http.Request, route string, userID uuid.UUID) bool {
+    limit, ok := cfg.rateLimits[route]
+    if !ok || cfg.rateLimiter == nil {
+        return true
+    }
+    res, err := cfg.rateLimiter.Take(r.Context(), route + ":user:" + userID.String(), limit, time.Now())
+    if err != nil || res.Allowed {
+        return true
+    }
+
+    w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusTooManyRequests)
+    w.Write([]byte(`{"error":"too many attempts"}`))
+    return false
+}
+
+// sweepRateLimits clears out full buckets from the shared store.
+func sweepRateLimits(ctx context.Context, store ratelimit.PostgresStore, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+
+        _, err := store.Sweep(ctx, time.Now())
+        if err != nil {
+            slog.Error("sweeping rate limit buckets failed", "err", err)
+        }
+    }
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/ratelimit"
+)
+
+func TestMiddlewareRateLimitChirps(t *testing.T) {
+    tests := []struct {
+        name string
+        red bool
+        wantAllowed int
+    }{
+        {
+            name: "Free",
+            wantAllowed: 2,
+        },
+        {
+            name: "Red gets its plan's limit",
+            red: true,
+            wantAllowed: 4,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            cfg.rateLimits["chirps"] = ratelimit.Limit{ Rate: 2, Per: time.Hour, Burst: 2 }
+            cfg.plans.Red.ChirpsPerMinute = 4
+            userID := uuid.New()
+            key, err := auth.MakeAPIKey()
+            if err != nil {
+                t.Fatal(err)
+            }
+            db.serveUser(testUser{ id: userID, email: "a@example.com", isChirpyRed: tt.red })
+            db.on("GetAPIKeyByHash", func([]driver.Value) fakeResult {
+                return rows("id,user_id,scope", row(uuid.New(), userID, auth.ScopeChirpsWrite))
+            })
+            db.on("TouchAPIKey", nil)
+            db.on("CountChirpsByUserWithin", func([]driver.Value) fakeResult { return rows("count", row(0)) })
+            db.on("CreateChirp", func(args []driver.Value) fakeResult {
+                return rows(chirpColumns, row(uuid.New(), time.Now(), time.Now(), args[0], userID, time.Now()))
+            })
+
+            handler := cfg.MiddlewareRateLimit("chirps", http.HandlerFunc(cfg.createChirp))
+            allowed := 0
+            for i := 0; i < 6; i++ {
+                w := record(handler.ServeHTTP, newRequest("POST", "/api/chirps", "Bearer " + key, `{"body": "hello"}`))
+                if w.Code == http.StatusCreated {
+                    allowed++
+                } else if w.Code != http.StatusTooManyRequests {
+                    t.Fatalf("request %d status = %d: %s", i + 1, w.Code, w.Body)
+                }
+            }
+            if allowed != tt.wantAllowed {
+                t.Errorf("%d chirps allowed, want %d", allowed, tt.wantAllowed)
+            }
+
+            // one lookup per request, shared by the limiter and createChirp
+            for _, name := range []string{ "GetAPIKeyByHash", "TouchAPIKey", "GetUserById" } {
+                if n := len(db.called(name)); n != 6 {
+                    t.Errorf("%s called %d times for 6 requests", name, n)
+                }
+            }
+        })
+    }
+}
+
+func TestRateLimitKey(t *testing.T) {
+    cfg, db := newTestConfig(t)
+    userID := uuid.New()
+    db.serveUser(testUser{ id: userID, email: "a@example.com" })
+
+    r := newRequest("POST", "/api/chirps", bearer(t, cfg, userID), "")
+    if got := cfg.rateLimitKey(r); got != "user:" + userID.String() {
+        t.Errorf("rateLimitKey() = %s, want the user", got)
+    }
+
+    // made up tokens don't get a bucket of their own
+    r = newRequest("POST", "/api/login", "Bearer made-up", "")
+    r.RemoteAddr = "192.0.2.1:1234"
+    if got := cfg.rateLimitKey(r); got != fmt.Sprintf("ip:%s", "192.0.2.1") {
+        t.Errorf("rateLimitKey() = %s, want the client address", got)
+    }
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/trice/Chirpy/internal/logging"
+	"github.com/trice/Chirpy/internal/tracing"
+)
+
+// MiddlewareLogging gives every request an ID and a logger carrying it, and
+// writes one line per request once it is done. Handlers get at the logger
+// with logging.FromContext so anything they log can be tied back to the
+// request.
+func (cfg *apiConfig) MiddlewareLogging(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        requestID := logging.RequestID(r.Header.Get(logging.RequestIDHeader))
+        w.Header().Set(logging.RequestIDHeader, requestID)
+
+        logger := slog.Default().With("request_id", requestID)
+        if span := tracing.SpanFromContext(r.Context()); span != nil {
+            logger = logger.With("trace_id", span.Context().TraceID.String())
+        }
+        ctx, info := logging.WithRequestInfo(logging.WithLogger(r.Context(), logger))
+        r = r.WithContext(ctx)
+
+        rec := &statusRecorder{ ResponseWriter: w }
+        next.ServeHTTP(rec, r)
+
+        // the mux fills in the pattern on the request it was handed, which
+        // is the one with our context
+        route := r.Pattern
+        if len(route) == 0 {
+            route = "unmatched"
+        }
+        if rec.status == 0 {
+            rec.status = http.StatusOK
+        }
+
+        level := slog.LevelInfo
+        if rec.status >= 500 {
+            level = slog.LevelError
+        }
+        logger.LogAttrs(ctx, level, "request",
+            slog.String("method", r.Method),
+            slog.String("route", route),
+            slog.String("path", r.URL.Path),
+            slog.Int("status", rec.status),
+            slog.Duration("latency", time.Since(start)),
+            slog.String("user_id", info.UserID()),
+        )
+    })
+}
@@ -0,0 +1,39 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scope, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW()
+)
+RETURNING id, name, prefix, scope, created_at, last_used_at;
+
+-- name: GetAPIKeyByHash :one
+-- keys of disabled or deleted users don't work
+SELECT api_keys.id, api_keys.user_id, api_keys.scope
+FROM api_keys
+JOIN users ON users.id = api_keys.user_id
+WHERE api_keys.key_hash=$1 AND users.disabled_at IS NULL AND users.deleted_at IS NULL;
+
+-- name: ListAPIKeysForUser :many
+SELECT id, name, prefix, scope, created_at, last_used_at
+FROM api_keys
+WHERE user_id=$1
+ORDER BY created_at ASC;
+
+-- name: TouchAPIKey :exec
+-- only write once a minute so busy scripts don't turn every read into a write
+UPDATE api_keys
+    SET last_used_at=NOW()
+    WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: DeleteAPIKeyForUser :execrows
+DELETE FROM api_keys
+    WHERE id=$1 AND user_id=$2;
+
+-- name: DeleteAPIKeysForUser :execrows
+DELETE FROM api_keys
+    WHERE user_id=$1;
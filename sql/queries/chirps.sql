@@ -1,30 +1,79 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+-- publish_at is only set for scheduled chirps, everything else goes out on
+-- the database's clock
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    COALESCE(sqlc.narg(publish_at), NOW())
+)
+RETURNING *;
+
+-- name: CreateChirpAt :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $1,
+    $2,
+    $3,
+    $1
 )
 RETURNING *;
 
 -- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, publish_at
 FROM chirps
-ORDER BY created_at ASC;
+WHERE publish_at <= NOW()
+    AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deleted_at IS NULL)
+ORDER BY publish_at ASC;
 
 -- name: GetChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, publish_at
 FROM chirps
-WHERE user_id=$1
-ORDER BY created_at ASC;
+WHERE user_id=$1 AND publish_at <= NOW()
+    AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deleted_at IS NULL)
+ORDER BY publish_at ASC;
 
 -- name: GetChirpById :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, publish_at
+FROM chirps
+WHERE id = $1
+    AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deleted_at IS NULL);
+
+-- name: GetPublishedChirpById :one
+-- like GetChirpById, but scheduled chirps aren't found until they go out
+SELECT id, created_at, updated_at, body, user_id, publish_at
 FROM chirps
-WHERE id = $1;
+WHERE id = $1 AND publish_at <= NOW()
+    AND EXISTS (SELECT 1 FROM users WHERE users.id = chirps.user_id AND users.deleted_at IS NULL);
 
 -- name: DeleteChirpForUser :exec
 DELETE FROM chirps
     WHERE id=$1 AND user_id=$2;
+
+-- name: UpdateChirpForUser :one
+UPDATE chirps
+    SET body=$3,
+    updated_at=NOW()
+    WHERE id=$1 AND user_id=$2
+RETURNING *;
+
+-- name: CountChirpsByUserWithin :one
+-- chirps from the last window_secs seconds
+SELECT COUNT(*)
+FROM chirps
+WHERE user_id=$1 AND created_at > NOW() - make_interval(secs => sqlc.arg(window_secs)::float8);
+
+-- name: DeleteChirpsByUser :execrows
+DELETE FROM chirps
+    WHERE user_id=$1;
+
+-- name: ListChirpsForUser :many
+SELECT id, created_at, updated_at, body, user_id, publish_at
+FROM chirps
+WHERE user_id=$1
+ORDER BY created_at ASC;
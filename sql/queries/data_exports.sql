@@ -0,0 +1,57 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (user_id)
+VALUES ($1)
+RETURNING id, user_id, status, error, created_at, completed_at, expires_at;
+
+-- name: GetLatestDataExport :one
+SELECT id, user_id, status, error, created_at, completed_at, expires_at
+FROM data_exports
+WHERE user_id=$1
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: GetDataExportArchive :one
+SELECT archive
+FROM data_exports
+WHERE id=$1 AND status='ready' AND expires_at > NOW();
+
+-- SKIP LOCKED lets several servers work through the queue without
+-- building the same export twice
+-- name: ClaimDataExport :one
+UPDATE data_exports
+    SET status='running',
+    started_at=NOW()
+    WHERE id = (
+        SELECT id FROM data_exports
+        WHERE status='pending'
+        ORDER BY created_at ASC
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED
+    )
+RETURNING id, user_id;
+
+-- name: CompleteDataExport :exec
+-- the archive can be downloaded for ttl_secs seconds
+UPDATE data_exports
+    SET status='ready',
+    archive=$2,
+    completed_at=NOW(),
+    expires_at=NOW() + make_interval(secs => sqlc.arg(ttl_secs)::float8)
+    WHERE id=$1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+    SET status='failed',
+    error=$2,
+    completed_at=NOW()
+    WHERE id=$1;
+
+-- exports a crashed worker left running
+-- name: RequeueStaleDataExports :execrows
+UPDATE data_exports
+    SET status='pending'
+    WHERE status='running' AND started_at < NOW() - make_interval(secs => sqlc.arg(stale_secs)::float8);
+
+-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports
+    WHERE expires_at <= NOW();
@@ -1,2 +0,0 @@
--- name: DeleteUser :exec
-DELETE FROM users;
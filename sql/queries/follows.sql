@@ -0,0 +1,16 @@
+-- name: CreateFollow :execrows
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: ListFollowers :many
+SELECT follower_id, created_at
+FROM follows
+WHERE followee_id=$1
+ORDER BY created_at ASC;
+
+-- name: ListFollowing :many
+SELECT followee_id, created_at
+FROM follows
+WHERE follower_id=$1
+ORDER BY created_at ASC;
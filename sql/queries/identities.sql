@@ -0,0 +1,22 @@
+-- name: CreateIdentity :one
+INSERT INTO identities (id, user_id, provider, subject, email, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetIdentity :one
+SELECT id, user_id, provider, subject, email, created_at
+FROM identities
+WHERE provider=$1 AND subject=$2;
+
+-- name: ListIdentitiesForUser :many
+SELECT provider, email, created_at
+FROM identities
+WHERE user_id=$1
+ORDER BY created_at ASC;
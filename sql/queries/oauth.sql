@@ -0,0 +1,35 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, name, redirect_uri, secret_hash, user_id, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT id, name, redirect_uri, secret_hash, user_id, created_at
+FROM oauth_clients
+WHERE id=$1;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scope, code_challenge, expires_at, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    NOW()
+);
+
+-- name: ConsumeOAuthCode :one
+UPDATE oauth_codes
+    SET used_at=NOW()
+    WHERE code_hash=$1 AND used_at IS NULL
+RETURNING *;
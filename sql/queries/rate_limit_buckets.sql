@@ -0,0 +1,23 @@
+-- name: TakeRateLimitToken :one
+-- tat is the time the bucket is full again, see internal/ratelimit
+INSERT INTO rate_limit_buckets (key, tat, updated_at)
+VALUES (
+    sqlc.arg(key),
+    sqlc.arg(now)::timestamp + make_interval(secs => sqlc.arg(interval_secs)::float8),
+    NOW()
+)
+ON CONFLICT (key) DO UPDATE
+    SET tat=GREATEST(rate_limit_buckets.tat, sqlc.arg(now)::timestamp) + make_interval(secs => sqlc.arg(interval_secs)::float8),
+    updated_at=NOW()
+    WHERE GREATEST(rate_limit_buckets.tat, sqlc.arg(now)::timestamp) + make_interval(secs => sqlc.arg(interval_secs)::float8)
+        <= sqlc.arg(now)::timestamp + make_interval(secs => sqlc.arg(burst_secs)::float8)
+RETURNING tat;
+
+-- name: GetRateLimitTAT :one
+SELECT tat
+FROM rate_limit_buckets
+WHERE key=$1;
+
+-- name: DeleteFullRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+    WHERE tat < $1;
@@ -22,3 +22,20 @@ UPDATE refresh_tokens
 SELECT user_id, expires_at, revoked_at
 FROM refresh_tokens
 WHERE token=$1;
+
+-- name: CountActiveRefreshTokens :one
+SELECT COUNT(*)
+FROM refresh_tokens
+WHERE revoked_at IS NULL AND expires_at > NOW();
+
+-- name: RevokeRefreshTokensForUser :execrows
+UPDATE refresh_tokens
+    SET revoked_at=NOW(),
+    updated_at=NOW()
+    WHERE user_id=$1 AND revoked_at IS NULL;
+
+-- name: ListRefreshTokensForUser :many
+SELECT created_at, expires_at, revoked_at
+FROM refresh_tokens
+WHERE user_id=$1
+ORDER BY created_at ASC;
@@ -0,0 +1,19 @@
+-- name: CountResetRows :one
+SELECT
+    (SELECT count(*) FROM users) AS users,
+    (SELECT count(*) FROM chirps) AS chirps,
+    (SELECT count(*) FROM follows) AS follows,
+    (SELECT count(*) FROM refresh_tokens) AS refresh_tokens,
+    (SELECT count(*) FROM user_totp) AS user_totp,
+    (SELECT count(*) FROM recovery_codes) AS recovery_codes,
+    (SELECT count(*) FROM identities) AS identities,
+    (SELECT count(*) FROM oauth_clients) AS oauth_clients,
+    (SELECT count(*) FROM oauth_codes) AS oauth_codes,
+    (SELECT count(*) FROM api_keys) AS api_keys,
+    (SELECT count(*) FROM webhook_events) AS webhook_events,
+    (SELECT count(*) FROM subscriptions) AS subscriptions,
+    (SELECT count(*) FROM rate_limit_buckets) AS rate_limit_buckets,
+    (SELECT count(*) FROM data_exports) AS data_exports;
+
+-- name: TruncateAll :exec
+TRUNCATE users, chirps, follows, refresh_tokens, user_totp, recovery_codes, identities, oauth_clients, oauth_codes, api_keys, webhook_events, subscriptions, rate_limit_buckets, data_exports RESTART IDENTITY CASCADE;
@@ -0,0 +1,64 @@
+-- name: UpsertSubscription :exec
+-- event_id is NULL for changes that don't come from Polka. A Polka event
+-- that already wrote the row changes nothing the second time.
+INSERT INTO subscriptions (user_id, plan, status, current_period_start, current_period_end, last_event_id, created_at, updated_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    sqlc.narg(event_id),
+    NOW(),
+    NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+    SET plan=EXCLUDED.plan,
+    status=EXCLUDED.status,
+    current_period_start=EXCLUDED.current_period_start,
+    current_period_end=EXCLUDED.current_period_end,
+    last_event_id=EXCLUDED.last_event_id,
+    updated_at=NOW()
+    WHERE EXCLUDED.last_event_id IS NULL OR subscriptions.last_event_id IS DISTINCT FROM EXCLUDED.last_event_id;
+
+-- name: GetSubscriptionForUser :one
+SELECT user_id, plan, status, current_period_start, current_period_end, created_at, updated_at, last_event_id
+FROM subscriptions
+WHERE user_id=$1;
+
+-- name: SetSubscriptionStatus :one
+UPDATE subscriptions
+    SET status=$2,
+    updated_at=NOW()
+    WHERE user_id=$1
+RETURNING *;
+
+-- name: RenewSubscription :execrows
+-- the new period picks up where the old one ended, unless it lapsed. Each
+-- event renews once, no rows means it did already or there's nothing to renew.
+UPDATE subscriptions
+    SET status='active',
+    current_period_start=GREATEST(current_period_end, NOW()),
+    current_period_end=COALESCE(sqlc.narg(period_end), GREATEST(current_period_end, NOW()) + make_interval(days => sqlc.arg(period_days)::int)),
+    last_event_id=sqlc.arg(event_id)::text,
+    updated_at=NOW()
+    WHERE user_id=sqlc.arg(user_id) AND last_event_id IS DISTINCT FROM sqlc.arg(event_id)::text;
+
+-- name: EndSubscription :exec
+UPDATE subscriptions
+    SET status='expired',
+    current_period_end=LEAST(current_period_end, NOW()),
+    updated_at=NOW()
+    WHERE user_id=$1;
+
+-- name: ExpireLapsedSubscriptions :execrows
+WITH expired AS (
+    UPDATE subscriptions
+        SET status='expired',
+        updated_at=NOW()
+        WHERE status <> 'expired' AND current_period_end < NOW()
+    RETURNING user_id
+)
+UPDATE users
+    SET is_chirpy_red=false
+    WHERE id IN (SELECT user_id FROM expired);
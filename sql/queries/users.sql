@@ -9,9 +9,22 @@ VALUES (
 )
 RETURNING id, created_at, updated_at, email, is_chirpy_red;
 
+-- name: CreateUserAt :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $1,
+    $2,
+    $3
+)
+RETURNING id, created_at, updated_at, email, is_chirpy_red;
 
 -- name: GetUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email=$1;
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, disabled_at, deleted_at, username, display_name, bio, avatar_url FROM users WHERE email=$1;
+
+-- name: GetUserById :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, disabled_at, deleted_at, username, display_name, bio, avatar_url FROM users WHERE id=$1;
 
 -- name: UpdateUser :one
 UPDATE users
@@ -26,3 +39,59 @@ UPDATE users
 SET is_chirpy_red=$1
 WHERE id=$2
 RETURNING id, created_at, updated_at, email, is_chirpy_red;
+
+-- name: SetUserDisabled :execrows
+UPDATE users
+SET disabled_at=$2,
+updated_at=NOW()
+WHERE id=$1;
+
+-- name: SetUserAdmin :execrows
+UPDATE users
+SET is_admin=$2,
+updated_at=NOW()
+WHERE id=$1;
+
+-- name: SoftDeleteUser :one
+UPDATE users
+SET deleted_at=NOW(),
+updated_at=NOW()
+WHERE id=$1 AND deleted_at IS NULL
+RETURNING deleted_at;
+
+-- name: RestoreUser :execrows
+-- only users deleted within the last grace_secs seconds
+UPDATE users
+SET deleted_at=NULL,
+updated_at=NOW()
+WHERE id=$1 AND deleted_at > NOW() - make_interval(secs => sqlc.arg(grace_secs)::float8);
+
+-- name: PurgeDeletedUsers :execrows
+-- users deleted more than grace_secs seconds ago
+DELETE FROM users
+WHERE deleted_at <= NOW() - make_interval(secs => sqlc.arg(grace_secs)::float8);
+
+-- name: GetPublicProfile :one
+SELECT id, username, display_name, bio, avatar_url, created_at
+FROM users
+WHERE id=$1 AND deleted_at IS NULL;
+
+-- name: GetPublicProfileByUsername :one
+SELECT id, username, display_name, bio, avatar_url, created_at
+FROM users
+WHERE lower(username)=lower($1) AND deleted_at IS NULL;
+
+-- name: ListPublicProfiles :many
+SELECT id, username, display_name, bio, avatar_url, created_at
+FROM users
+WHERE id = ANY(@ids::uuid[]) AND deleted_at IS NULL;
+
+-- name: UpdateProfile :one
+UPDATE users
+SET username=$2,
+display_name=$3,
+bio=$4,
+avatar_url=$5,
+updated_at=NOW()
+WHERE id=$1
+RETURNING id, username, display_name, bio, avatar_url, created_at;
@@ -0,0 +1,46 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, source, event_id, event_type, payload, received_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+ON CONFLICT (source, event_id) DO NOTHING
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT id, source, event_id, event_type, payload, status, error, attempts, received_at, processed_at
+FROM webhook_events
+WHERE id=$1;
+
+-- name: GetWebhookEventBySourceID :one
+SELECT id, source, event_id, event_type, payload, status, error, attempts, received_at, processed_at
+FROM webhook_events
+WHERE source=$1 AND event_id=$2;
+
+-- name: ListWebhookEvents :many
+SELECT id, source, event_id, event_type, payload, status, error, attempts, received_at, processed_at
+FROM webhook_events
+WHERE sqlc.arg(status)::text = '' OR status=sqlc.arg(status)::text
+ORDER BY received_at DESC
+LIMIT sqlc.arg(max_rows);
+
+-- name: ClaimWebhookEvent :one
+-- locks the event for the rest of the transaction, a concurrent delivery of
+-- the same event waits and then finds it already processed
+UPDATE webhook_events
+    SET status='processing'
+    WHERE id=sqlc.arg(id) AND (status IN ('pending', 'failed') OR sqlc.arg(force)::bool)
+RETURNING *;
+
+-- name: FinishWebhookEvent :one
+UPDATE webhook_events
+    SET status=$2,
+    error=$3,
+    attempts=attempts + 1,
+    processed_at=NOW()
+    WHERE id=$1
+RETURNING *;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+    id UUID PRIMARY KEY,
+    source TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    error TEXT DEFAULT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    received_at TIMESTAMP NOT NULL,
+    processed_at TIMESTAMP DEFAULT NULL,
+    UNIQUE (source, event_id)
+);
+
+-- +goose Down
+DROP TABLE webhook_events;
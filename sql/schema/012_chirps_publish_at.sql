@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE chirps
+    ADD COLUMN publish_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+UPDATE chirps SET publish_at=created_at;
+
+-- +goose Down
+ALTER TABLE chirps
+    DROP COLUMN publish_at;
@@ -0,0 +1,55 @@
+-- +goose Up
+-- users and chirps were created without primary keys, so their ids could
+-- be NULL. Give any such rows an id before making them required.
+UPDATE users SET id = gen_random_uuid() WHERE id IS NULL;
+UPDATE users SET created_at = NOW() WHERE created_at IS NULL;
+UPDATE users SET updated_at = created_at WHERE updated_at IS NULL;
+UPDATE chirps SET id = gen_random_uuid() WHERE id IS NULL;
+
+-- the old UNIQUE constraint stays, every foreign key to users(id) depends
+-- on its index
+ALTER TABLE users
+    ALTER COLUMN id SET DEFAULT gen_random_uuid(),
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN created_at SET DEFAULT NOW(),
+    ALTER COLUMN updated_at SET NOT NULL,
+    ALTER COLUMN updated_at SET DEFAULT NOW(),
+    ADD PRIMARY KEY (id);
+
+ALTER TABLE chirps
+    ALTER COLUMN id SET DEFAULT gen_random_uuid(),
+    ALTER COLUMN created_at SET DEFAULT NOW(),
+    ALTER COLUMN updated_at SET DEFAULT NOW(),
+    ADD PRIMARY KEY (id);
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN created_at SET DEFAULT NOW(),
+    ALTER COLUMN updated_at SET DEFAULT NOW();
+
+-- an author's chirps by date, and a user's sessions when revoking them all
+CREATE INDEX chirps_user_id_created_at_idx ON chirps (user_id, created_at);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_id_idx;
+DROP INDEX chirps_user_id_created_at_idx;
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN updated_at DROP DEFAULT;
+
+ALTER TABLE chirps
+    DROP CONSTRAINT chirps_pkey,
+    ALTER COLUMN id DROP NOT NULL,
+    ALTER COLUMN id DROP DEFAULT,
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN updated_at DROP DEFAULT;
+
+ALTER TABLE users
+    DROP CONSTRAINT users_pkey,
+    ALTER COLUMN id DROP NOT NULL,
+    ALTER COLUMN id DROP DEFAULT,
+    ALTER COLUMN created_at DROP NOT NULL,
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN updated_at DROP NOT NULL,
+    ALTER COLUMN updated_at DROP DEFAULT;
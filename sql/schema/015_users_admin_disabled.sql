@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN disabled_at TIMESTAMP DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN disabled_at,
+    DROP COLUMN is_admin;
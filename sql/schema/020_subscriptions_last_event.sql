@@ -0,0 +1,9 @@
+-- +goose Up
+-- the Polka event that last changed the subscription, so replaying an event
+-- doesn't extend the period a second time
+ALTER TABLE subscriptions
+    ADD COLUMN last_event_id TEXT DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE subscriptions
+    DROP COLUMN last_event_id;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- publish_at is compared with NOW() and with times clients send, which only
+-- agree when the column knows its zone. Existing values were written as the
+-- database's local time, which is how the conversion reads them.
+ALTER TABLE chirps
+    ALTER COLUMN publish_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN publish_at SET DEFAULT NOW();
+
+-- +goose Down
+ALTER TABLE chirps
+    ALTER COLUMN publish_at TYPE TIMESTAMP,
+    ALTER COLUMN publish_at SET DEFAULT NOW();
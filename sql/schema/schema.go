@@ -0,0 +1,8 @@
+// Package schema embeds the goose migrations in this directory so the
+// binary can migrate its own database, see internal/migrate.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/trice/Chirpy/internal/database"
+	"github.com/trice/Chirpy/internal/logging"
+	"github.com/trice/Chirpy/internal/oidc"
+)
+
+const oidcFlowCookie = "chirpy_oidc"
+
+// loadOIDCProviders reads OIDC_PROVIDERS, a comma separated list of names,
+// and the OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and _REDIRECT_URL
+// settings for each of them.
+func loadOIDCProviders() map[string]*oidc.Provider {
+    providers := map[string]*oidc.Provider{}
+    for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+        name = strings.ToLower(strings.TrimSpace(name))
+        if len(name) == 0 {
+            continue
+        }
+        prefix := "OIDC_" + strings.ToUpper(name) + "_"
+        providers[name] = &oidc.Provider {
+            Name: name,
+            Issuer: os.Getenv(prefix + "ISSUER"),
+            ClientID: os.Getenv(prefix + "CLIENT_ID"),
+            ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+            RedirectURL: os.Getenv(prefix + "REDIRECT_URL"),
+        }
+    }
+    return providers
+}
+
+// oidcLogin sends the browser off to the identity provider. The state, nonce
+// and PKCE verifier ride along in a signed cookie until the callback.
+func (cfg *apiConfig) oidcLogin(w http.ResponseWriter, r *http.Request) {
+    name := r.PathValue("provider")
+    provider, ok := cfg.oidcProviders[name]
+    if !ok {
+        http.Error(w, "unknown provider", http.StatusNotFound)
+        return
+    }
+
+    flow, err := oidc.NewFlow(name)
+    if err != nil {
+        http.Error(w, "something went wrong", http.StatusInternalServerError)
+        return
+    }
+
+    flowTok, err := oidc.MakeFlowToken(flow, cfg.tokenSecret, 10 * time.Minute)
+    if err != nil {
+        http.Error(w, "something went wrong", http.StatusInternalServerError)
+        return
+    }
+
+    authURL, err := provider.AuthCodeURL(r.Context(), flow.State, flow.Nonce, oidc.PKCEChallenge(flow.Verifier))
+    if err != nil {
+        http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+        return
+    }
+
+    http.SetCookie(w, &http.Cookie {
+        Name: oidcFlowCookie,
+        Value: flowTok,
+        Path: "/api/auth/",
+        MaxAge: 600,
+        HttpOnly: true,
+        Secure: cfg.platform != "dev",
+        SameSite: http.SameSiteLaxMode,
+    })
+    http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallback finishes the code flow and logs in the user tied to the
+// provider identity. Unknown identities are linked to an existing account
+// with the same verified email, or get a new password-less account.
+func (cfg *apiConfig) oidcCallback(w http.ResponseWriter, r *http.Request) {
+    name := r.PathValue("provider")
+    provider, ok := cfg.oidcProviders[name]
+    if !ok {
+        http.Error(w, "unknown provider", http.StatusNotFound)
+        return
+    }
+
+    cookie, err := r.Cookie(oidcFlowCookie)
+    if err != nil {
+        http.Error(w, "login flow expired", http.StatusBadRequest)
+        return
+    }
+    http.SetCookie(w, &http.Cookie{ Name: oidcFlowCookie, Path: "/api/auth/", MaxAge: -1 })
+
+    flow, err := oidc.ParseFlowToken(cookie.Value, cfg.tokenSecret)
+    if err != nil || flow.Provider != name || flow.State != r.URL.Query().Get("state") {
+        http.Error(w, "invalid login state", http.StatusBadRequest)
+        return
+    }
+
+    if idpErr := r.URL.Query().Get("error"); len(idpErr) != 0 {
+        // the error comes from the query string, anyone can put anything
+        // in it, so it only goes to the log
+        logging.FromContext(r.Context()).Warn("identity provider refused the login", "provider", name, "error", idpErr)
+        http.Error(w, "login failed", http.StatusUnauthorized)
+        return
+    }
+
+    claims, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), flow.Verifier, flow.Nonce)
+    if err != nil {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    userRow, err := cfg.userForIdentity(r, name, claims)
+    if errors.Is(err, errEmailNotVerified) {
+        http.Error(w, "a verified email is required", http.StatusForbidden)
+        return
+    }
+    if errors.Is(err, errIdentityConflict) {
+        http.Error(w, "this email is already tied to another account", http.StatusConflict)
+        return
+    }
+    if err != nil {
+        logging.FromContext(r.Context()).Error("linking identity failed", "provider", name, "err", err)
+        http.Error(w, "something went wrong", http.StatusInternalServerError)
+        return
+    }
+
+    cfg.finishLogin(w, r, userRow)
+}
+
+var (
+    errEmailNotVerified = errors.New("a verified email is required")
+    errIdentityConflict = errors.New("identity conflicts with an existing account")
+)
+
+// userForIdentity finds or creates the user for a provider identity. A new
+// account and its identity are created together, so a failure never leaves
+// a password-less account nobody can sign in to.
+func (cfg *apiConfig) userForIdentity(r *http.Request, provider string, claims oidc.Claims) (database.User, error) {
+    identity, err := cfg.queries.GetIdentity(r.Context(), database.GetIdentityParams{ Provider: provider, Subject: claims.Subject })
+    if err == nil {
+        return cfg.queries.GetUserById(r.Context(), identity.UserID)
+    }
+    if !errors.Is(err, sql.ErrNoRows) {
+        return database.User{}, err
+    }
+
+    // only trust the email for linking when the provider vouches for it,
+    // otherwise anyone could claim somebody else's account
+    if len(claims.Email) == 0 || !claims.EmailVerified {
+        return database.User{}, errEmailNotVerified
+    }
+
+    tx, err := cfg.db.BeginTx(r.Context(), nil)
+    if err != nil {
+        return database.User{}, err
+    }
+    defer tx.Rollback()
+    qtx := cfg.queriesTx(tx)
+
+    userRow, err := qtx.GetUser(r.Context(), claims.Email)
+    if errors.Is(err, sql.ErrNoRows) {
+        // an empty hash never matches, so the account can't log in with a password
+        _, err = qtx.CreateUser(r.Context(), database.CreateUserParams{ Email: claims.Email, HashedPassword: "" })
+        if err == nil {
+            userRow, err = qtx.GetUser(r.Context(), claims.Email)
+        }
+    }
+    if err == nil {
+        param := database.CreateIdentityParams {
+            UserID: userRow.ID,
+            Provider: provider,
+            Subject: claims.Subject,
+            Email: claims.Email,
+        }
+        _, err = qtx.CreateIdentity(r.Context(), param)
+    }
+
+    // somebody signed up with the email, or linked the identity, while we
+    // were looking
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+        return database.User{}, errIdentityConflict
+    }
+    if err == nil {
+        err = tx.Commit()
+    }
+    if err != nil {
+        return database.User{}, err
+    }
+    return userRow, nil
+}
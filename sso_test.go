@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/trice/Chirpy/internal/oidc"
+)
+
+func TestUserForIdentity(t *testing.T) {
+    userID := uuid.New()
+    tests := []struct {
+        name string
+        claims oidc.Claims
+        existing bool
+        identityErr error
+        wantErr error
+        wantAnyErr bool
+        wantCreateUser bool
+    }{
+        {
+            name: "New account",
+            claims: oidc.Claims{ RegisteredClaims: jwt.RegisteredClaims{ Subject: "sub" }, Email: "a@example.com", EmailVerified: true },
+            wantCreateUser: true,
+        },
+        {
+            name: "Links an existing account",
+            claims: oidc.Claims{ RegisteredClaims: jwt.RegisteredClaims{ Subject: "sub" }, Email: "a@example.com", EmailVerified: true },
+            existing: true,
+        },
+        {
+            name: "Unverified email",
+            claims: oidc.Claims{ RegisteredClaims: jwt.RegisteredClaims{ Subject: "sub" }, Email: "a@example.com" },
+            wantErr: errEmailNotVerified,
+        },
+        {
+            name: "Linked by someone else meanwhile",
+            claims: oidc.Claims{ RegisteredClaims: jwt.RegisteredClaims{ Subject: "sub" }, Email: "a@example.com", EmailVerified: true },
+            existing: true,
+            identityErr: &pq.Error{ Code: "23505" },
+            wantErr: errIdentityConflict,
+        },
+        {
+            name: "Database failure isn't a conflict",
+            claims: oidc.Claims{ RegisteredClaims: jwt.RegisteredClaims{ Subject: "sub" }, Email: "a@example.com", EmailVerified: true },
+            existing: true,
+            identityErr: fmt.Errorf("connection reset"),
+            wantAnyErr: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            db.on("GetIdentity", nil)
+            created := false
+            db.on("GetUser", func([]driver.Value) fakeResult {
+                if !tt.existing && !created {
+                    return rows(userColumns)
+                }
+                return rows(userColumns, testUser{ id: userID, email: "a@example.com" }.row())
+            })
+            db.on("CreateUser", func(args []driver.Value) fakeResult {
+                created = true
+                return rows("id,created_at,updated_at,email,is_chirpy_red", row(userID, time.Now(), time.Now(), args[0], false))
+            })
+            db.on("CreateIdentity", func(args []driver.Value) fakeResult {
+                if tt.identityErr != nil {
+                    return fakeResult{ err: tt.identityErr }
+                }
+                return rows("id,user_id,provider,subject,email,created_at", row(uuid.New(), args[0], args[1], args[2], args[3], time.Now()))
+            })
+
+            r := httptest.NewRequest("GET", "/api/auth/test/callback", nil)
+            got, err := cfg.userForIdentity(r, "test", tt.claims)
+            if tt.wantErr != nil || tt.wantAnyErr {
+                if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+                    t.Fatalf("userForIdentity() error = %v, want %v", err, tt.wantErr)
+                }
+                if tt.wantAnyErr && (errors.Is(err, errIdentityConflict) || errors.Is(err, errEmailNotVerified)) {
+                    t.Errorf("userForIdentity() error = %v, want a plain failure", err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("userForIdentity() error = %v", err)
+            }
+            if got.ID != userID {
+                t.Errorf("userForIdentity() = %v, want %v", got.ID, userID)
+            }
+            if created != tt.wantCreateUser {
+                t.Errorf("CreateUser called = %v, want %v", created, tt.wantCreateUser)
+            }
+        })
+    }
+}
+
+func TestOIDCCallbackProviderError(t *testing.T) {
+    cfg, _ := newTestConfig(t)
+    cfg.oidcProviders = map[string]*oidc.Provider{ "test": { Name: "test" } }
+    flow, err := oidc.NewFlow("test")
+    if err != nil {
+        t.Fatal(err)
+    }
+    token, err := oidc.MakeFlowToken(flow, cfg.tokenSecret, time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    idpErr := url.QueryEscape("<script>alert(1)</script>")
+    r := newRequest("GET", "/api/auth/test/callback?state=" + flow.State + "&error=" + idpErr, "", "")
+    r.SetPathValue("provider", "test")
+    r.AddCookie(&http.Cookie{ Name: oidcFlowCookie, Value: token })
+    w := record(cfg.oidcCallback, r)
+    if w.Code != http.StatusUnauthorized {
+        t.Fatalf("oidcCallback() status = %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body)
+    }
+    // the provider's error is only logged, never echoed back
+    if got := w.Body.String(); got != "login failed\n" {
+        t.Errorf("oidcCallback() body = %q, want %q", got, "login failed\n")
+    }
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/database"
+)
+
+// Subscription states. Canceled and past due members keep Red until the
+// period they paid for ends, expireSubscriptions takes it away after that.
+const (
+    subscriptionActive = "active"
+    subscriptionPastDue = "past_due"
+    subscriptionCanceled = "canceled"
+    subscriptionExpired = "expired"
+)
+
+const (
+    defaultPlan = "red_monthly"
+    defaultPeriod = 30 * 24 * time.Hour
+)
+
+// applyPolkaEvent moves the user's subscription along for one webhook
+// payload through qtx, the transaction that claimed the event. Applying the
+// same eventID twice leaves the period alone. It returns the status code for
+// Polka and the outcome to record.
+func (cfg *apiConfig) applyPolkaEvent(ctx context.Context, qtx *database.Queries, eventID string, payload []byte) (int, string, error) {
+    type data struct {
+        UserId uuid.UUID `json:"user_id"`
+        Plan string `json:"plan"`
+        PeriodEnd *time.Time `json:"period_end"`
+    }
+
+    type body struct {
+        Event string `json:"event"`
+        Data data `json:"data"`
+    }
+
+    rb := body{}
+    err := json.Unmarshal(payload, &rb)
+    if err != nil {
+        return http.StatusBadRequest, "failed", err
+    }
+
+    now := time.Now()
+    periodEnd := now.Add(defaultPeriod)
+    if rb.Data.PeriodEnd != nil {
+        periodEnd = *rb.Data.PeriodEnd
+    }
+    plan := rb.Data.Plan
+    if len(plan) == 0 {
+        plan = defaultPlan
+    }
+
+    switch rb.Event {
+    case "user.upgraded":
+        err = setRed(ctx, qtx, rb.Data.UserId, true)
+        if err == nil {
+            err = qtx.UpsertSubscription(ctx, database.UpsertSubscriptionParams {
+                UserID: rb.Data.UserId,
+                Plan: plan,
+                Status: subscriptionActive,
+                CurrentPeriodStart: now,
+                CurrentPeriodEnd: periodEnd,
+                EventID: sql.NullString{ String: eventID, Valid: true },
+            })
+        }
+
+    case "subscription.renewed":
+        err = setRed(ctx, qtx, rb.Data.UserId, true)
+        if err == nil {
+            param := database.RenewSubscriptionParams {
+                PeriodDays: int32(defaultPeriod / (24 * time.Hour)),
+                EventID: eventID,
+                UserID: rb.Data.UserId,
+            }
+            if rb.Data.PeriodEnd != nil {
+                param.PeriodEnd = sql.NullTime{ Time: *rb.Data.PeriodEnd, Valid: true }
+            }
+            var n int64
+            n, err = qtx.RenewSubscription(ctx, param)
+            if err == nil && n == 0 {
+                // either this event renewed it already, or there's nothing
+                // to renew
+                _, err = qtx.GetSubscriptionForUser(ctx, rb.Data.UserId)
+            }
+        }
+
+    case "payment.failed":
+        _, err = qtx.SetSubscriptionStatus(ctx, database.SetSubscriptionStatusParams{ UserID: rb.Data.UserId, Status: subscriptionPastDue })
+
+    case "subscription.canceled":
+        _, err = qtx.SetSubscriptionStatus(ctx, database.SetSubscriptionStatusParams{ UserID: rb.Data.UserId, Status: subscriptionCanceled })
+
+    case "user.downgraded":
+        // unlike a cancellation this takes effect right away
+        err = setRed(ctx, qtx, rb.Data.UserId, false)
+        if err == nil {
+            err = qtx.EndSubscription(ctx, rb.Data.UserId)
+        }
+
+    default:
+        return http.StatusNoContent, "ignored", nil
+    }
+
+    if errors.Is(err, sql.ErrNoRows) {
+        return http.StatusNotFound, "failed", fmt.Errorf("no user or subscription for %s", rb.Data.UserId)
+    }
+    if err != nil {
+        return http.StatusInternalServerError, "failed", err
+    }
+
+    return http.StatusNoContent, "processed", nil
+}
+
+func setRed(ctx context.Context, q *database.Queries, userID uuid.UUID, red bool) error {
+    param := database.UpdateRedParams {
+        ID: userID,
+        IsChirpyRed: red,
+    }
+    _, err := q.UpdateRed(ctx, param)
+    return err
+}
+
+// expireSubscriptions takes Red away from members whose period ran out,
+// checking every interval until ctx is done.
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        n, err := cfg.queries.ExpireLapsedSubscriptions(ctx)
+        if err != nil {
+            slog.Error("expiring subscriptions failed", "err", err)
+        } else if n > 0 {
+            slog.Info("expired subscriptions", "count", n)
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (cfg *apiConfig) getMySubscription(w http.ResponseWriter, r *http.Request) {
+    validUuid := validateAccessToken(r, w, cfg)
+    if validUuid == (uuid.UUID{}) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+
+    sub, err := cfg.queries.GetSubscriptionForUser(r.Context(), validUuid)
+    if errors.Is(err, sql.ErrNoRows) {
+        http.Error(w, "no subscription", http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, "Error reading subscription", http.StatusInternalServerError)
+        return
+    }
+
+    d, _ := json.Marshal(sub)
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    w.Write(d)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const subscriptionColumns = "user_id,plan,status,current_period_start,current_period_end,created_at,updated_at,last_event_id"
+
+func TestApplyPolkaEvent(t *testing.T) {
+    userID := uuid.New()
+    tests := []struct {
+        name string
+        payload string
+        noUser bool
+        noSubscription bool
+        // what RenewSubscription reports, the subscription was renewed by
+        // this event already when it's 0
+        renewed int64
+        wantCode int
+        wantStatus string
+        wantQueries []string
+        wantRed any
+    }{
+        {
+            name: "Upgraded",
+            payload: `{"event": "user.upgraded", "data": {"user_id": "USER"}}`,
+            wantCode: http.StatusNoContent,
+            wantStatus: "processed",
+            wantQueries: []string{ "UpdateRed", "UpsertSubscription" },
+            wantRed: true,
+        },
+        {
+            name: "Renewed",
+            payload: `{"event": "subscription.renewed", "data": {"user_id": "USER"}}`,
+            renewed: 1,
+            wantCode: http.StatusNoContent,
+            wantStatus: "processed",
+            wantQueries: []string{ "UpdateRed", "RenewSubscription" },
+            wantRed: true,
+        },
+        {
+            name: "Renewed by this event before",
+            payload: `{"event": "subscription.renewed", "data": {"user_id": "USER"}}`,
+            renewed: 0,
+            wantCode: http.StatusNoContent,
+            wantStatus: "processed",
+            wantQueries: []string{ "UpdateRed", "RenewSubscription", "GetSubscriptionForUser" },
+            wantRed: true,
+        },
+        {
+            name: "Renewed without a subscription",
+            payload: `{"event": "subscription.renewed", "data": {"user_id": "USER"}}`,
+            noSubscription: true,
+            wantCode: http.StatusNotFound,
+            wantStatus: "failed",
+            wantQueries: []string{ "UpdateRed", "RenewSubscription", "GetSubscriptionForUser" },
+            wantRed: true,
+        },
+        {
+            name: "Payment failed",
+            payload: `{"event": "payment.failed", "data": {"user_id": "USER"}}`,
+            wantCode: http.StatusNoContent,
+            wantStatus: "processed",
+            wantQueries: []string{ "SetSubscriptionStatus" },
+        },
+        {
+            name: "Canceled",
+            payload: `{"event": "subscription.canceled", "data": {"user_id": "USER"}}`,
+            wantCode: http.StatusNoContent,
+            wantStatus: "processed",
+            wantQueries: []string{ "SetSubscriptionStatus" },
+        },
+        {
+            name: "Downgraded",
+            payload: `{"event": "user.downgraded", "data": {"user_id": "USER"}}`,
+            wantCode: http.StatusNoContent,
+            wantStatus: "processed",
+            wantQueries: []string{ "UpdateRed", "EndSubscription" },
+            wantRed: false,
+        },
+        {
+            name: "Unknown user",
+            payload: `{"event": "user.upgraded", "data": {"user_id": "USER"}}`,
+            noUser: true,
+            wantCode: http.StatusNotFound,
+            wantStatus: "failed",
+            wantQueries: []string{ "UpdateRed" },
+            wantRed: true,
+        },
+        {
+            name: "Other events are ignored",
+            payload: `{"event": "user.payment_method_updated", "data": {"user_id": "USER"}}`,
+            wantCode: http.StatusNoContent,
+            wantStatus: "ignored",
+        },
+        {
+            name: "Not JSON",
+            payload: `{"event": `,
+            wantCode: http.StatusBadRequest,
+            wantStatus: "failed",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            subscription := func() fakeResult {
+                if tt.noSubscription {
+                    return rows(subscriptionColumns)
+                }
+                now := time.Now()
+                return rows(subscriptionColumns, row(userID, "red_monthly", "active", now, now.Add(time.Hour), now, now, "evt_1"))
+            }
+            db.on("UpdateRed", func(args []driver.Value) fakeResult {
+                if tt.noUser {
+                    return rows("id,created_at,updated_at,email,is_chirpy_red")
+                }
+                return rows("id,created_at,updated_at,email,is_chirpy_red", row(userID, time.Now(), time.Now(), "a@example.com", args[0]))
+            })
+            db.on("UpsertSubscription", nil)
+            db.on("RenewSubscription", func([]driver.Value) fakeResult { return affected(tt.renewed) })
+            db.on("GetSubscriptionForUser", func([]driver.Value) fakeResult { return subscription() })
+            db.on("SetSubscriptionStatus", func([]driver.Value) fakeResult { return subscription() })
+            db.on("EndSubscription", nil)
+
+            payload := []byte(strings.ReplaceAll(tt.payload, "USER", userID.String()))
+            code, status, err := cfg.applyPolkaEvent(t.Context(), cfg.queries, "evt_1", payload)
+            if code != tt.wantCode || status != tt.wantStatus {
+                t.Fatalf("applyPolkaEvent() = %d, %s, %v, want %d, %s", code, status, err, tt.wantCode, tt.wantStatus)
+            }
+            if (err != nil) != (tt.wantStatus == "failed") {
+                t.Errorf("applyPolkaEvent() error = %v", err)
+            }
+
+            var got []string
+            for _, c := range db.calls {
+                got = append(got, c.name)
+            }
+            if strings.Join(got, ",") != strings.Join(tt.wantQueries, ",") {
+                t.Errorf("queries = %v, want %v", got, tt.wantQueries)
+            }
+            if calls := db.called("UpdateRed"); len(calls) != 0 && calls[0][0] != tt.wantRed {
+                t.Errorf("UpdateRed is_chirpy_red = %v, want %v", calls[0][0], tt.wantRed)
+            }
+        })
+    }
+}
+
+func TestRenewalArgs(t *testing.T) {
+    periodEnd := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+    tests := []struct {
+        name string
+        data string
+        wantPeriodEnd any
+    }{
+        {
+            name: "Period from Polka",
+            data: `"period_end": "2030-01-02T03:04:05Z"`,
+            wantPeriodEnd: periodEnd,
+        },
+        {
+            name: "Default period is left to the database",
+            data: `"plan": "red_monthly"`,
+            wantPeriodEnd: nil,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            userID := uuid.New()
+            db.on("UpdateRed", func(args []driver.Value) fakeResult {
+                return rows("id,created_at,updated_at,email,is_chirpy_red", row(userID, time.Now(), time.Now(), "a@example.com", true))
+            })
+            db.on("RenewSubscription", func([]driver.Value) fakeResult { return affected(1) })
+
+            payload := `{"event": "subscription.renewed", "data": {"user_id": "` + userID.String() + `", ` + tt.data + `}}`
+            cfg.applyPolkaEvent(t.Context(), cfg.queries, "evt_2", []byte(payload))
+
+            calls := db.called("RenewSubscription")
+            if len(calls) != 1 {
+                t.Fatalf("RenewSubscription called %d times, want once", len(calls))
+            }
+            args := calls[0]
+            if got, ok := args[0].(time.Time); ok && !got.Equal(periodEnd) || !ok && args[0] != tt.wantPeriodEnd {
+                t.Errorf("RenewSubscription period_end = %v, want %v", args[0], tt.wantPeriodEnd)
+            }
+            if args[1] != int64(30) || args[2] != "evt_2" || args[3] != userID.String() {
+                t.Errorf("RenewSubscription args = %v", args)
+            }
+        })
+    }
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/tracing"
+)
+
+// newTracer picks the span exporter from the standard OpenTelemetry
+// variables: OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT
+// send to a collector, OTEL_TRACES_EXPORTER=console writes to stdout.
+// Without either, trace context is still passed along but nothing is
+// recorded.
+func newTracer() (*tracing.Tracer, tracing.Exporter) {
+    service := os.Getenv("OTEL_SERVICE_NAME")
+    if len(service) == 0 {
+        service = "chirpy"
+    }
+
+    var exporter tracing.Exporter
+    endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+    if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); len(endpoint) == 0 && len(base) != 0 {
+        endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+    }
+    switch {
+    case os.Getenv("OTEL_TRACES_EXPORTER") == "none":
+    case len(endpoint) != 0:
+        exporter = tracing.NewOTLPExporter(endpoint, service)
+    case os.Getenv("OTEL_TRACES_EXPORTER") == "console":
+        exporter = &tracing.WriterExporter{ Out: os.Stdout, Service: service }
+    }
+    return tracing.NewTracer(exporter), exporter
+}
+
+// MiddlewareTracing starts a server span for every request, continuing the
+// caller's trace when it sent a traceparent header. The span is named after
+// the route by MiddlewareSpanRoute further in.
+func (cfg *apiConfig) MiddlewareTracing(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ctx := r.Context()
+        if remote, ok := tracing.Extract(r.Header); ok {
+            ctx = tracing.ContextWithRemoteParent(ctx, remote)
+        }
+        ctx, span := cfg.tracer.Start(ctx, r.Method, tracing.KindServer,
+            tracing.String("http.request.method", r.Method),
+            tracing.String("url.path", r.URL.Path),
+        )
+        defer span.End()
+        r = r.WithContext(ctx)
+
+        rec := &statusRecorder{ ResponseWriter: w }
+        next.ServeHTTP(rec, r)
+
+        if rec.status == 0 {
+            rec.status = http.StatusOK
+        }
+        span.SetAttributes(tracing.Int("http.response.status_code", rec.status))
+        if rec.status >= 500 {
+            span.SetError(errServerError)
+        }
+    })
+}
+
+var errServerError = errors.New("server error")
+
+// MiddlewareSpanRoute names the request's span after the route the mux
+// matched. It has to sit right around the mux, which only fills in the
+// pattern on the request it was handed, and the middlewares further out
+// have passed on copies of theirs.
+func (cfg *apiConfig) MiddlewareSpanRoute(mux http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        mux.ServeHTTP(w, r)
+
+        span := tracing.SpanFromContext(r.Context())
+        if span != nil && len(r.Pattern) != 0 {
+            span.SetName(r.Pattern)
+            span.SetAttributes(tracing.String("http.route", r.Pattern))
+        }
+    })
+}
+
+// checkPassword is auth.CheckPasswordHash in its own span, bcrypt being
+// slow on purpose and worth telling apart from the queries around it
+func (cfg *apiConfig) checkPassword(ctx context.Context, password, hash string) error {
+    _, span := cfg.tracer.Start(ctx, "bcrypt.compare", tracing.KindInternal)
+    defer span.End()
+    return auth.CheckPasswordHash(password, hash)
+}
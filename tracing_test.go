@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/trice/Chirpy/internal/tracing"
+)
+
+type recordingExporter struct {
+    mu sync.Mutex
+    spans []tracing.SpanData
+}
+
+func (e *recordingExporter) Export(span tracing.SpanData) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    e.spans = append(e.spans, span)
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error { return nil }
+
+func TestMiddlewareTracingRoute(t *testing.T) {
+    tests := []struct {
+        name string
+        target string
+        wantName string
+        wantRoute string
+        wantStatus int64
+    }{
+        {
+            name: "Matched route",
+            target: "/api/chirps/0d7e4209-a8da-44c9-8c54-dc689477c5e5",
+            wantName: "GET /api/chirps/{chirpID}",
+            wantRoute: "GET /api/chirps/{chirpID}",
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "No route",
+            target: "/nowhere",
+            wantName: "GET",
+            wantStatus: http.StatusNotFound,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, _ := newTestConfig(t)
+            exporter := &recordingExporter{}
+            cfg.tracer = tracing.NewTracer(exporter)
+
+            mux := http.NewServeMux()
+            mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {})
+            // the same chain main serves
+            handler := cfg.MiddlewareTracing(cfg.MiddlewareLogging(cfg.MiddlewareMetrics(cfg.MiddlewareSpanRoute(mux))))
+            handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.target, nil))
+
+            if len(exporter.spans) != 1 {
+                t.Fatalf("exported %d spans, want 1", len(exporter.spans))
+            }
+            span := exporter.spans[0]
+            if span.Name != tt.wantName {
+                t.Errorf("span name = %q, want %q", span.Name, tt.wantName)
+            }
+            attrs := map[string]any{}
+            for _, a := range span.Attributes {
+                attrs[a.Key] = a.Value
+            }
+            if route, _ := attrs["http.route"].(string); route != tt.wantRoute {
+                t.Errorf("http.route = %q, want %q", route, tt.wantRoute)
+            }
+            if attrs["http.response.status_code"] != tt.wantStatus {
+                t.Errorf("http.response.status_code = %v, want %d", attrs["http.response.status_code"], tt.wantStatus)
+            }
+        })
+    }
+}
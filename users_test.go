@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/trice/Chirpy/internal/auth"
+	"github.com/trice/Chirpy/internal/database"
+)
+
+func TestUpdateUser(t *testing.T) {
+    userID := uuid.New()
+    tests := []struct {
+        name string
+        hash string
+        noToken bool
+        body string
+        // whose reauth_token goes into the body: "self", "other" or
+        // "access" for an access token in its place
+        reauth string
+        updateErr error
+        wantStatus int
+        wantEmail string
+        wantNewPassword string
+    }{
+        {
+            name: "Change email",
+            body: `{"email": "new@example.com", "current_password": "hunter2"}`,
+            wantStatus: http.StatusOK,
+            wantEmail: "new@example.com",
+        },
+        {
+            name: "Change password",
+            body: `{"password": "correct horse", "current_password": "hunter2"}`,
+            wantStatus: http.StatusOK,
+            wantEmail: "old@example.com",
+            wantNewPassword: "correct horse",
+        },
+        {
+            name: "Wrong current password",
+            body: `{"email": "new@example.com", "current_password": "nope"}`,
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Missing current password",
+            body: `{"password": "correct horse"}`,
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Empty email",
+            body: `{"email": "", "current_password": "hunter2"}`,
+            wantStatus: http.StatusBadRequest,
+        },
+        {
+            name: "Email taken",
+            body: `{"email": "taken@example.com", "current_password": "hunter2"}`,
+            updateErr: &pq.Error{ Code: "23505" },
+            wantStatus: http.StatusConflict,
+        },
+        {
+            name: "No token",
+            noToken: true,
+            body: `{"email": "new@example.com", "current_password": "hunter2"}`,
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "Identity provider account without a fresh sign in",
+            hash: "-",
+            body: `{"email": "new@example.com"}`,
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Identity provider account can't set a password without a fresh sign in",
+            hash: "-",
+            body: `{"password": "correct horse", "current_password": ""}`,
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Identity provider account with a fresh sign in",
+            hash: "-",
+            body: `{"email": "new@example.com"}`,
+            reauth: "self",
+            wantStatus: http.StatusOK,
+            wantEmail: "new@example.com",
+        },
+        {
+            name: "Somebody else's sign in",
+            hash: "-",
+            body: `{"email": "new@example.com"}`,
+            reauth: "other",
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Access token passed off as a sign in",
+            hash: "-",
+            body: `{"email": "new@example.com"}`,
+            reauth: "access",
+            wantStatus: http.StatusForbidden,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            hash := mustHash(t, "hunter2")
+            if tt.hash == "-" {
+                hash = ""
+            }
+            db.serveUser(testUser{ id: userID, email: "old@example.com", hash: hash })
+            db.on("UpdateUser", func(args []driver.Value) fakeResult {
+                if tt.updateErr != nil {
+                    return fakeResult{ err: tt.updateErr }
+                }
+                return rows("id,created_at,updated_at,email,is_chirpy_red", row(userID, time.Now(), time.Now(), args[0], false))
+            })
+
+            authorization := bearer(t, cfg, userID)
+            if tt.noToken {
+                authorization = ""
+            }
+            body := tt.body
+            if len(tt.reauth) != 0 {
+                body = strings.TrimSuffix(body, "}") + `, "reauth_token": "` + reauthToken(t, cfg, userID, tt.reauth) + `"}`
+            }
+            w := do(cfg.updateUser, "PUT", "/api/users", authorization, body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("updateUser() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if tt.wantStatus == http.StatusForbidden {
+                if n := len(db.called("UpdateUser")); n != 0 {
+                    t.Errorf("UpdateUser called %d times without proof it's the owner", n)
+                }
+            }
+            if tt.wantStatus != http.StatusOK {
+                return
+            }
+
+            calls := db.called("UpdateUser")
+            if len(calls) != 1 {
+                t.Fatalf("UpdateUser called %d times, want once", len(calls))
+            }
+            if calls[0][0] != tt.wantEmail {
+                t.Errorf("UpdateUser email = %v, want %s", calls[0][0], tt.wantEmail)
+            }
+            newHash, _ := calls[0][1].(string)
+            if len(tt.wantNewPassword) != 0 && auth.CheckPasswordHash(tt.wantNewPassword, newHash) != nil {
+                t.Errorf("UpdateUser didn't store the new password")
+            }
+            if len(tt.wantNewPassword) == 0 && newHash != hash {
+                t.Errorf("UpdateUser changed the password hash")
+            }
+        })
+    }
+}
+
+func TestLogin(t *testing.T) {
+    switchedOff := sql.NullTime{ Time: time.Now().Add(-time.Hour), Valid: true }
+    tests := []struct {
+        name string
+        password string
+        disabled bool
+        deleted bool
+        wantStatus int
+    }{
+        {
+            name: "Right password",
+            password: "hunter2",
+            wantStatus: http.StatusOK,
+        },
+        {
+            name: "Wrong password",
+            password: "nope",
+            wantStatus: http.StatusUnauthorized,
+        },
+        {
+            name: "Disabled account",
+            password: "hunter2",
+            disabled: true,
+            wantStatus: http.StatusForbidden,
+        },
+        {
+            name: "Deleted account",
+            password: "hunter2",
+            deleted: true,
+            wantStatus: http.StatusUnauthorized,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            userID := uuid.New()
+            user := testUser{ id: userID, email: "a@example.com", hash: mustHash(t, "hunter2"), isAdmin: true }
+            if tt.disabled {
+                user.disabledAt = switchedOff
+            }
+            if tt.deleted {
+                user.deletedAt = switchedOff
+            }
+            db.serveUser(user)
+            db.on("GetTOTPForUser", nil)
+            db.on("CreateRefreshToken", nil)
+
+            body := `{"email": "a@example.com", "password": "` + tt.password + `"}`
+            w := do(cfg.login, "POST", "/api/login", "", body)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("login() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if tt.wantStatus != http.StatusOK {
+                if n := len(db.called("CreateRefreshToken")); n != 0 {
+                    t.Errorf("login() handed out %d refresh tokens", n)
+                }
+                return
+            }
+
+            got := map[string]any{}
+            err := json.Unmarshal(w.Body.Bytes(), &got)
+            if err != nil {
+                t.Fatalf("login() body isn't JSON: %v", err)
+            }
+            for _, key := range []string{ "id", "email", "token", "refresh_token" } {
+                if _, ok := got[key]; !ok {
+                    t.Errorf("login() response is missing %s", key)
+                }
+            }
+            for _, key := range []string{ "hashed_password", "is_admin", "disabled_at", "deleted_at" } {
+                if _, ok := got[key]; ok {
+                    t.Errorf("login() response leaks %s", key)
+                }
+            }
+        })
+    }
+}
+
+func TestIssueSessionReauthToken(t *testing.T) {
+    tests := []struct {
+        name string
+        hash string
+        wantReauth bool
+    }{
+        {
+            name: "Password account confirms its password instead",
+            hash: "$2a$04$notarealhash",
+        },
+        {
+            name: "Identity provider account",
+            wantReauth: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            db.on("CreateRefreshToken", nil)
+            userRow := database.User{ ID: uuid.New(), Email: "a@example.com", HashedPassword: tt.hash }
+
+            w := record(func(w http.ResponseWriter, r *http.Request) { cfg.issueSession(w, r, userRow) }, newRequest("POST", "/api/login", "", ""))
+            if w.Code != http.StatusOK {
+                t.Fatalf("issueSession() status = %d: %s", w.Code, w.Body)
+            }
+            got := struct {
+                ReauthToken *string `json:"reauth_token"`
+            }{}
+            json.Unmarshal(w.Body.Bytes(), &got)
+            if (got.ReauthToken != nil) != tt.wantReauth {
+                t.Fatalf("issueSession() reauth_token = %v, want one %v", got.ReauthToken, tt.wantReauth)
+            }
+            if !tt.wantReauth {
+                return
+            }
+            userID, err := auth.ValidateReauthToken(*got.ReauthToken, cfg.tokenSecret)
+            if err != nil || userID != userRow.ID {
+                t.Errorf("reauth_token is for %v, %v, want %s", userID, err, userRow.ID)
+            }
+        })
+    }
+}
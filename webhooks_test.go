@@ -0,0 +1,168 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/trice/Chirpy/internal/webhook"
+)
+
+const webhookEventColumns = "id,source,event_id,event_type,payload,status,error,attempts,received_at,processed_at"
+
+func webhookEventRow(id uuid.UUID, status string, payload string) []driver.Value {
+    return row(id, "polka", "evt_1", "user.upgraded", []byte(payload), status, nil, 1, time.Now(), nil)
+}
+
+func TestReplayWebhookEvent(t *testing.T) {
+    eventID := uuid.New()
+    userID := uuid.New()
+    payload := `{"event": "user.downgraded", "data": {"user_id": "` + userID.String() + `"}}`
+
+    tests := []struct {
+        name string
+        status string
+        target string
+        wantStatus int
+        wantApplied bool
+    }{
+        {
+            name: "Failed event is replayed",
+            status: "failed",
+            target: "/admin/webhooks/" + eventID.String() + "/replay",
+            wantStatus: http.StatusOK,
+            wantApplied: true,
+        },
+        {
+            name: "Processed event needs force",
+            status: "processed",
+            target: "/admin/webhooks/" + eventID.String() + "/replay",
+            wantStatus: http.StatusConflict,
+        },
+        {
+            name: "Processed event with force",
+            status: "processed",
+            target: "/admin/webhooks/" + eventID.String() + "/replay?force=true",
+            wantStatus: http.StatusOK,
+            wantApplied: true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            cfg.adminKey = "admin-key"
+            db.on("GetWebhookEvent", func([]driver.Value) fakeResult {
+                return rows(webhookEventColumns, webhookEventRow(eventID, tt.status, payload))
+            })
+            db.on("ClaimWebhookEvent", func(args []driver.Value) fakeResult {
+                force, _ := args[1].(bool)
+                if (tt.status == "pending" || tt.status == "failed") || force {
+                    return rows(webhookEventColumns, webhookEventRow(eventID, "processing", payload))
+                }
+                return rows(webhookEventColumns)
+            })
+            db.on("UpdateRed", func(args []driver.Value) fakeResult {
+                return rows("id,created_at,updated_at,email,is_chirpy_red", row(userID, time.Now(), time.Now(), "a@example.com", false))
+            })
+            db.on("EndSubscription", nil)
+            db.on("FinishWebhookEvent", func(args []driver.Value) fakeResult {
+                return rows(webhookEventColumns, webhookEventRow(eventID, args[1].(string), payload))
+            })
+
+            r := newRequest("POST", tt.target, "ApiKey admin-key", "")
+            r.SetPathValue("eventID", eventID.String())
+            w := record(cfg.replayWebhookEvent, r)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("replayWebhookEvent() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if applied := len(db.called("UpdateRed")) != 0; applied != tt.wantApplied {
+                t.Errorf("event applied = %v, want %v", applied, tt.wantApplied)
+            }
+        })
+    }
+}
+
+func TestProcessWebhookEventFailure(t *testing.T) {
+    cfg, db := newTestConfig(t)
+    eventID := uuid.New()
+    userID := uuid.New()
+    payload := `{"event": "user.upgraded", "data": {"user_id": "` + userID.String() + `"}}`
+    db.on("ClaimWebhookEvent", func([]driver.Value) fakeResult {
+        return rows(webhookEventColumns, webhookEventRow(eventID, "processing", payload))
+    })
+    // the user is gone
+    db.on("UpdateRed", func([]driver.Value) fakeResult { return rows("id,created_at,updated_at,email,is_chirpy_red") })
+    db.on("FinishWebhookEvent", func(args []driver.Value) fakeResult {
+        return rows(webhookEventColumns, webhookEventRow(eventID, args[1].(string), payload))
+    })
+
+    code, event, err := cfg.processWebhookEvent(t.Context(), eventID, false)
+    if err != nil {
+        t.Fatalf("processWebhookEvent() error = %v", err)
+    }
+    if code != http.StatusNotFound || event.Status != "failed" {
+        t.Errorf("processWebhookEvent() = %d, %s, want %d, failed", code, event.Status, http.StatusNotFound)
+    }
+}
+
+func TestChirpyRedPayment(t *testing.T) {
+    eventID := uuid.New()
+    userID := uuid.New()
+    data := `"event": "user.upgraded", "data": {"user_id": "` + userID.String() + `"}`
+
+    tests := []struct {
+        name string
+        payload string
+        wantStatus int
+        wantRecorded bool
+    }{
+        {
+            name: "With an event id",
+            payload: `{"id": "evt_1", ` + data + `}`,
+            wantStatus: http.StatusNoContent,
+            wantRecorded: true,
+        },
+        {
+            name: "Without an event id",
+            payload: `{` + data + `}`,
+            wantStatus: http.StatusBadRequest,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg, db := newTestConfig(t)
+            cfg.polkaKey = "polka-key"
+            db.on("CreateWebhookEvent", func([]driver.Value) fakeResult {
+                return rows(webhookEventColumns, webhookEventRow(eventID, "pending", tt.payload))
+            })
+            db.on("ClaimWebhookEvent", func([]driver.Value) fakeResult {
+                return rows(webhookEventColumns, webhookEventRow(eventID, "processing", tt.payload))
+            })
+            db.on("UpdateRed", func([]driver.Value) fakeResult {
+                return rows("id,created_at,updated_at,email,is_chirpy_red", row(userID, time.Now(), time.Now(), "a@example.com", true))
+            })
+            db.on("UpsertSubscription", nil)
+            db.on("FinishWebhookEvent", func(args []driver.Value) fakeResult {
+                return rows(webhookEventColumns, webhookEventRow(eventID, args[1].(string), tt.payload))
+            })
+
+            r := newRequest("POST", "/api/polka/webhooks", "", tt.payload)
+            r.Header.Set(webhook.SignatureHeader, webhook.Sign([]byte(cfg.polkaKey), []byte(tt.payload), time.Now()))
+            w := record(cfg.chirpyRedPayment, r)
+            if w.Code != tt.wantStatus {
+                t.Fatalf("chirpyRedPayment() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            calls := db.called("CreateWebhookEvent")
+            if recorded := len(calls) != 0; recorded != tt.wantRecorded {
+                t.Fatalf("CreateWebhookEvent called = %v, want %v", recorded, tt.wantRecorded)
+            }
+            if tt.wantRecorded && calls[0][1] != "evt_1" {
+                t.Errorf("CreateWebhookEvent event id = %v, want evt_1", calls[0][1])
+            }
+        })
+    }
+}